@@ -0,0 +1,67 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// activated holds listeners passed in by systemd socket activation, keyed
+// by their FileDescriptorName. Unnamed sockets are called http and https
+// in order.
+var activated = sync.OnceValue(func() map[string]net.Listener {
+	ls := make(map[string]net.Listener)
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return ls
+	}
+	n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	defaults := []string{"http", "https"}
+	for i := 0; i < n; i++ {
+		name := ""
+		if i < len(names) && names[i] != "unknown" {
+			name = names[i]
+		}
+		if name == "" && len(defaults) > 0 {
+			name, defaults = defaults[0], defaults[1:]
+		}
+		f := os.NewFile(uintptr(3+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			slog.Warn("socket activation", "fd", 3+i, "name", name, "err", err)
+			continue
+		}
+		ls[name] = l
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	return ls
+})
+
+// binding counts the servers main has started which have yet to bind, so
+// that privileges are only dropped once they all have. listen and
+// listenPacket mark a server as bound.
+var binding sync.WaitGroup
+
+// listen returns the activated listener called name or else listens on addr.
+func listen(name, addr string) (net.Listener, error) {
+	defer binding.Done()
+	if l, ok := activated()[name]; ok {
+		slog.Info("using activated socket", "name", name, "addr", l.Addr())
+		return l, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenPacket listens for UDP datagrams on addr.
+func listenPacket(addr string) (net.PacketConn, error) {
+	defer binding.Done()
+	return net.ListenPacket("udp", addr)
+}
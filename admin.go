@@ -0,0 +1,182 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+//go:embed dashboard.html
+var dashboard []byte
+
+// adminMux serves operator endpoints on -adminPort, away from the endpoints
+// under test so that degrading those never locks the operator out.
+var adminMux = http.NewServeMux()
+
+func init() {
+	adminMux.HandleFunc("/", adminRoot)
+	adminMux.HandleFunc("/admin/leak", adminLeak)
+	adminMux.HandleFunc("/admin/stats", adminStats)
+	adminMux.HandleFunc("/admin/faults", adminFaults)
+	adminMux.HandleFunc("/admin/rules", adminRules)
+	adminMux.HandleFunc("/admin/health", adminHealth)
+	adminMux.HandleFunc("/admin/reload", adminReload)
+	adminMux.HandleFunc("/dashboard", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboard)
+	})
+}
+
+// adminSecurity protects the admin endpoints, which control every fault, on
+// shared networks.
+type adminSecurity struct {
+	token    string // required as a bearer token or basic auth password if set
+	certfile string // certificate and key to serve TLS with if set
+	clientCA string // CA certificates client certificates must chain to if set
+}
+
+// tlsConfig loads the TLS configuration of as, nil without a certificate.
+func (as adminSecurity) tlsConfig() (*tls.Config, error) {
+	if as.certfile == "" {
+		if as.clientCA != "" {
+			return nil, errors.New("client certificates need TLS")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(as.certfile, as.certfile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if as.clientCA != "" {
+		pem, err := os.ReadFile(as.clientCA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates in " + as.clientCA)
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// authorize wraps h to refuse requests without the token. The token may be
+// sent as a bearer token or, so that browsers can show the dashboard, as the
+// password of basic auth.
+func (as adminSecurity) authorize(h http.Handler) http.Handler {
+	if as.token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			_, got, ok = r.BasicAuth()
+		}
+		if !ok || !authEqual(got, as.token) {
+			slog.Warn("unauthorized admin request", "remote", r.RemoteAddr, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Basic realm="slowserver admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serveAdmin serves adminMux on addr, secured as as says.
+func serveAdmin(addr string, as adminSecurity) {
+	cfg, err := as.tlsConfig()
+	if err != nil {
+		fatal("admin tls", "err", err)
+	}
+	slog.Info("admin listening", "addr", addr, "tls", cfg != nil, "token", as.token != "", "clientCerts", as.clientCA != "")
+	l, err := listen("admin", addr)
+	if err != nil {
+		fatal("admin listen", "err", err)
+	}
+	srv := &http.Server{
+		Handler:   as.authorize(adminMux),
+		ErrorLog:  slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		TLSConfig: cfg,
+	}
+	if cfg != nil {
+		fatal("admin serve", "err", srv.ServeTLS(l, "", ""))
+	}
+	fatal("admin serve", "err", srv.Serve(l))
+}
+
+// mountDebug adds pprof and expvar to the admin endpoints.
+func mountDebug() {
+	adminMux.HandleFunc("/debug/pprof/", pprof.Index)
+	adminMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	adminMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	adminMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	adminMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	adminMux.Handle("/debug/vars", expvar.Handler())
+}
+
+func adminRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	io.WriteString(w, `Admin endpoints on this server:
+	/admin/leak - show leaked goroutines and file descriptors (GET) or release them (POST)
+	/admin/stats - request, connection and fault counters by endpoint as JSON
+	/admin/faults - show (GET) or set (POST) runtime faults - accepts form values: wan, pause
+	/admin/rules - show (GET), replace (PUT with a JSON array) or remove (DELETE) the -rules
+	/admin/health - show (GET) or change (POST) /healthz and /readyz - accepts form values: probe, state (up, down, auto), flapEvery, flapFor
+	/admin/reload - reload the -rules and -scenarios files (POST), as SIGHUP does; -mocks are not reloaded
+	/dashboard - a live view of /admin/stats with buttons for /admin/faults
+	/debug/pprof/ - Go profiles (with -debug)
+	/debug/vars - expvar variables (with -debug)
+`)
+}
+
+// adminFaults shows the runtime fault toggles on GET. On POST, wan sets the
+// wan profile used by requests which do not pick their own and pause stops
+// the world for a duration.
+func adminFaults(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		if wan, ok := r.Form["wan"]; ok {
+			if err := setGlobalWan(wan[0]); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if p := r.Form.Get("pause"); p != "" {
+			d, err := time.ParseDuration(p)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			go pauseWorld(d)
+		}
+	}
+	var names []string
+	for name := range wanProfiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"wan":         *globalWan.Load(),
+		"wanProfiles": names,
+		"paused":      pausedUntil.Load() != nil,
+	})
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// altSvc returns a handler advertising broken alternative services, as the
+// mode query param says:
+//
+//	wrongport - h2 and h3 on port, by default 1 where nothing listens
+//	h3        - h3 on the https port, which doesn't speak QUIC
+//	tls       - h2 on the https port, slowed like everything else here
+//	clear     - Alt-Svc: clear, withdrawing earlier advertisements
+//
+// The alt query param sends a raw Alt-Svc value instead, and ma sets the
+// max-age of the advertisement.
+func altSvc(httpsPort int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		ma := int(timeQueryParam(q, "ma", 24*time.Hour).Seconds())
+		v := q.Get("alt")
+		if v == "" {
+			switch mode := q.Get("mode"); mode {
+			case "", "wrongport":
+				p := intQueryParam(q, "port", 1)
+				v = fmt.Sprintf(`h3=":%d"; ma=%d, h2=":%d"; ma=%d`, p, ma, p, ma)
+			case "h3":
+				v = fmt.Sprintf(`h3=":%d"; ma=%d`, httpsPort, ma)
+			case "tls":
+				v = fmt.Sprintf(`h2=":%d"; ma=%d`, httpsPort, ma)
+			case "clear":
+				v = "clear"
+			default:
+				http.Error(w, "unknown mode "+mode, http.StatusBadRequest)
+				return
+			}
+		}
+		noteFault(r, "altSvc")
+		time.Sleep(timeQueryParam(q, "delay", 0))
+		w.Header().Set("Alt-Svc", v)
+		fmt.Fprintf(w, "Alt-Svc: %s\n", v)
+	}
+}
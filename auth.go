@@ -0,0 +1,127 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const authRealm = "slowserver"
+
+// authHandler wraps check, which reports whether r carries valid
+// credentials, with the behavior common to the /auth endpoints. The user,
+// password and token query params set the expected credentials, failDelay
+// slows only failed attempts and flaky rejects that share of valid ones.
+func authHandler(scheme string, check func(r *http.Request, user, password, token string) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		user, password, token := q.Get("user"), q.Get("password"), q.Get("token")
+		if user == "" {
+			user = "user"
+		}
+		if password == "" {
+			password = "passwd"
+		}
+		if token == "" {
+			token = "token"
+		}
+		time.Sleep(timeQueryParam(q, "delay", 0))
+		ok := check(r, user, password, token)
+		if ok {
+			if f := q.Get("flaky"); f != "" && rng.Float64() < percent(f) {
+				noteFault(r, "authFlaky")
+				ok = false
+			}
+		}
+		if !ok {
+			time.Sleep(timeQueryParam(q, "failDelay", 0))
+			w.Header().Set("WWW-Authenticate", authChallenge(scheme))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, "authenticated with %s\n", scheme)
+	}
+}
+
+// authChallenge returns the WWW-Authenticate header value for scheme.
+func authChallenge(scheme string) string {
+	switch scheme {
+	case "Digest":
+		b := make([]byte, 16)
+		rand.Read(b)
+		return fmt.Sprintf(`Digest realm=%q, qop="auth", algorithm=MD5, nonce="%x"`, authRealm, b)
+	case "Bearer":
+		return fmt.Sprintf(`Bearer realm=%q, error="invalid_token"`, authRealm)
+	}
+	return fmt.Sprintf(`Basic realm=%q`, authRealm)
+}
+
+func authEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authBasic requires HTTP basic authentication.
+var authBasic = authHandler("Basic", func(r *http.Request, user, password, _ string) bool {
+	u, p, ok := r.BasicAuth()
+	return ok && authEqual(u, user) && authEqual(p, password)
+})
+
+// authBearer requires a bearer token.
+var authBearer = authHandler("Bearer", func(r *http.Request, _, _, token string) bool {
+	t, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && authEqual(t, token)
+})
+
+// authDigest requires RFC 2617 digest authentication with MD5. Any nonce is
+// accepted, so the server keeps no state.
+var authDigest = authHandler("Digest", func(r *http.Request, user, password, _ string) bool {
+	a, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Digest ")
+	if !ok {
+		return false
+	}
+	p := digestParams(a)
+	if !authEqual(p["username"], user) {
+		return false
+	}
+	md5hex := func(s string) string {
+		h := md5.Sum([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	ha1 := md5hex(user + ":" + p["realm"] + ":" + password)
+	ha2 := md5hex(r.Method + ":" + p["uri"])
+	want := md5hex(ha1 + ":" + p["nonce"] + ":" + ha2)
+	if p["qop"] != "" {
+		want = md5hex(ha1 + ":" + p["nonce"] + ":" + p["nc"] + ":" + p["cnonce"] + ":" + p["qop"] + ":" + ha2)
+	}
+	return p["realm"] == authRealm && authEqual(p["response"], want)
+})
+
+// digestParams parses the comma separated key=value pairs of a digest
+// Authorization header.
+func digestParams(s string) map[string]string {
+	m := make(map[string]string)
+	for len(s) > 0 {
+		k, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		k = strings.TrimSpace(k)
+		var v string
+		if strings.HasPrefix(rest, `"`) {
+			v, rest, _ = strings.Cut(rest[1:], `"`)
+			_, rest, _ = strings.Cut(rest, ",")
+		} else {
+			v, rest, _ = strings.Cut(rest, ",")
+		}
+		m[k] = strings.TrimSpace(v)
+		s = rest
+	}
+	return m
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vbackend is a virtual backend instance living inside this process. Requests
+// to /vb/... are routed to one of them by hash of a header, so the effect of a
+// rolling deploy on clients can be studied without a real deployment.
+type vbackend struct {
+	id    int
+	delay time.Duration
+
+	mu    sync.Mutex
+	gen   int
+	down  bool
+	conns map[net.Conn]struct{}
+}
+
+var vbackends []*vbackend
+
+// initVBackends creates n virtual backends. delays is a comma separated list
+// of per instance response delays which is cycled if shorter than n.
+func initVBackends(n int, delays string) {
+	var ds []time.Duration
+	for _, s := range strings.Split(delays, ",") {
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			slog.Warn("could not parse virtual backend delay", "delay", s, "err", err)
+			continue
+		}
+		ds = append(ds, d)
+	}
+	for i := 0; i < n; i++ {
+		vb := &vbackend{id: i, conns: make(map[net.Conn]struct{})}
+		if len(ds) > 0 {
+			vb.delay = ds[i%len(ds)]
+		}
+		vbackends = append(vbackends, vb)
+	}
+}
+
+// instanceID identifies the instance and how many times it was restarted.
+func (vb *vbackend) instanceID() string {
+	vb.mu.Lock()
+	defer vb.mu.Unlock()
+	return "vb-" + strconv.Itoa(vb.id) + "-gen" + strconv.Itoa(vb.gen)
+}
+
+// restart takes the instance down for downFor. Hijacked connections such as
+// websockets are closed as if the process exited; in flight HTTP requests are
+// left to drain.
+func (vb *vbackend) restart(downFor time.Duration) {
+	vb.mu.Lock()
+	vb.down = true
+	for c := range vb.conns {
+		c.Close()
+	}
+	vb.conns = make(map[net.Conn]struct{})
+	vb.mu.Unlock()
+	slog.Info("virtual backend down", "id", vb.id, "for", downFor)
+	time.Sleep(downFor)
+	vb.mu.Lock()
+	vb.down = false
+	vb.gen++
+	vb.mu.Unlock()
+	slog.Info("virtual backend up", "id", vb.id)
+}
+
+// rollingRestarts restarts one instance at a time, every interval, forever.
+func rollingRestarts(every, downFor time.Duration) {
+	for {
+		for _, vb := range vbackends {
+			time.Sleep(every)
+			vb.restart(downFor)
+		}
+	}
+}
+
+// vbHandler routes /vb/<path> to a virtual backend chosen by hash of the
+// header named key (or the client IP if it is absent) and serves <path> from
+// h on behalf of that instance.
+func vbHandler(h http.Handler, key string) http.Handler {
+	return http.StripPrefix("/vb", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := fnv.New32a()
+		f.Write([]byte(clientKey(r, key)))
+		vb := vbackends[int(f.Sum32()%uint32(len(vbackends)))]
+		w.Header().Set("X-Instance-Id", vb.instanceID())
+		vb.mu.Lock()
+		down := vb.down
+		vb.mu.Unlock()
+		if down {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "instance restarting", http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(vb.delay)
+		h.ServeHTTP(&vbWriter{ResponseWriter: w, vb: vb}, r)
+	}))
+}
+
+// vbWriter tracks connections hijacked by handlers served on behalf of a
+// virtual backend so they can be closed when it restarts.
+type vbWriter struct {
+	http.ResponseWriter
+	vb *vbackend
+}
+
+func (w *vbWriter) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *vbWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c, brw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err != nil {
+		return c, brw, err
+	}
+	w.vb.mu.Lock()
+	if w.vb.down {
+		c.Close()
+	} else {
+		w.vb.conns[c] = struct{}{}
+	}
+	w.vb.mu.Unlock()
+	return c, brw, err
+}
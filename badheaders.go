@@ -0,0 +1,71 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// badHeaderModes write the header lines of /badheaders for each mode.
+var badHeaderModes = map[string]func(w io.Writer, size int64){
+	// Header names with separators and controls, values with NUL and DEL.
+	"invalid": func(w io.Writer, _ int64) {
+		io.WriteString(w, "Bad Name: space in name\r\nBad(Name): separators\r\nX-Ctl\x01: control\r\nX-Nul: a\x00b\r\nX-Del: a\x7fb\r\n")
+	},
+	// Lines ended by a bare LF and values split by a bare CR.
+	"crlf": func(w io.Writer, _ int64) {
+		io.WriteString(w, "X-Bare-LF: one\nX-Bare-CR: a\rX-Smuggled: b\r\nX-After: ok\r\n")
+	},
+	// Latin-1 and invalid UTF-8 bytes in names and values.
+	"utf8": func(w io.Writer, _ int64) {
+		io.WriteString(w, "X-Latin1: caf\xe9\r\nX-Invalid: \xff\xfe\xc3\x28\r\nX-N\xe4me: value\r\n")
+	},
+	// One enormous header line, streamed so that it is never held in memory.
+	"long": func(w io.Writer, size int64) {
+		io.WriteString(w, "X-Long: ")
+		io.CopyN(w, repeatReader('l'), size)
+		io.WriteString(w, "\r\n")
+	},
+	// Obsolete line folding.
+	"fold": func(w io.Writer, _ int64) {
+		io.WriteString(w, "X-Folded: first\r\n  continued\r\n\tand again\r\n")
+	},
+}
+
+// badHeaders hijacks the connection to write a response whose headers are
+// malformed as the mode query param says: invalid, crlf, utf8, long (of
+// size bytes) or fold. The connection is closed after the body.
+func badHeaders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	mode := q.Get("mode")
+	if mode == "" {
+		mode = "invalid"
+	}
+	lines, ok := badHeaderModes[mode]
+	if !ok {
+		http.Error(w, "unknown mode "+mode, http.StatusBadRequest)
+		return
+	}
+	time.Sleep(timeQueryParam(q, "delay", 0))
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "bad headers need HTTP/1.1", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	c, brw, err := hj.Hijack()
+	if err != nil {
+		slog.Warn("badheaders hijack", "err", err)
+		return
+	}
+	defer c.Close()
+	noteFault(r, "badHeaders")
+	body := "bad headers: " + mode + "\n"
+	io.WriteString(brw, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n")
+	lines(brw, sizeQueryParam(q, "size", 1<<20))
+	fmt.Fprintf(brw, "Content-Length: %d\r\nConnection: close\r\n\r\n%s", len(body), body)
+	brw.Flush()
+}
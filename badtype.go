@@ -0,0 +1,83 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"time"
+)
+
+const badTypeJSON = `{"message": "this is JSON", "ok": true}` + "\n"
+
+// badTypes are the lies /badtype can tell: a Content-Type, possibly a
+// Content-Encoding, and the body actually sent.
+var badTypes = map[string]func() (ctype, encoding string, body []byte){
+	"jsonhtml": func() (string, string, []byte) {
+		return "text/html; charset=utf-8", "", []byte(badTypeJSON)
+	},
+	"gzipjson": func() (string, string, []byte) {
+		return "application/json", "", gzipBytes([]byte(badTypeJSON))
+	},
+	"htmljson": func() (string, string, []byte) {
+		return "application/json", "", []byte("<html><body><h1>502 Bad Gateway</h1></body></html>\n")
+	},
+	"charset": func() (string, string, []byte) {
+		return "application/json; charset=utf-16", "", []byte(badTypeJSON)
+	},
+	"image": func() (string, string, []byte) {
+		return "image/png", "", []byte(badTypeJSON)
+	},
+	"none": func() (string, string, []byte) {
+		return "", "", []byte(badTypeJSON)
+	},
+	"encoding": func() (string, string, []byte) {
+		return "application/json", "gzip", []byte(badTypeJSON)
+	},
+}
+
+func gzipBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// badType serves a body with the wrong Content-Type or Content-Encoding as
+// the mode query param says:
+//
+//	jsonhtml - JSON labeled text/html
+//	gzipjson - gzip bytes labeled application/json
+//	htmljson - an HTML error page labeled application/json
+//	charset  - UTF-8 JSON labeled charset=utf-16
+//	image    - JSON labeled image/png
+//	none     - no Content-Type, with sniffing forbidden
+//	encoding - plain JSON labeled Content-Encoding: gzip
+func badType(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	mode := q.Get("mode")
+	if mode == "" {
+		mode = "jsonhtml"
+	}
+	lie, ok := badTypes[mode]
+	if !ok {
+		http.Error(w, "unknown mode "+mode, http.StatusBadRequest)
+		return
+	}
+	ctype, encoding, body := lie()
+	time.Sleep(timeQueryParam(q, "delay", 0))
+	noteFault(r, "badType")
+	// A nil Content-Type stops net/http sniffing one.
+	w.Header()["Content-Type"] = nil
+	if ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	} else {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	w.Write(body)
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sharedBucket caps the combined bytes per second written by everyone using
+// it, so that concurrent clients slow each other down.
+type sharedBucket struct {
+	rate int64 // bytes per second
+
+	mu   sync.Mutex
+	next time.Time // when the bytes reserved so far have all been sent
+}
+
+// wait reserves time to send n bytes after everything reserved before and
+// sleeps until it is over.
+func (b *sharedBucket) wait(n int) {
+	b.mu.Lock()
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	b.next = b.next.Add(time.Duration(int64(n) * int64(time.Second) / b.rate))
+	until := b.next
+	b.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
+
+// sharedCaps is a repeatable flag of bandwidth caps shared by all requests
+// to an endpoint, such as /slow=1MB, or to every endpoint with *=10MB.
+type sharedCaps map[string]*sharedBucket
+
+func (c *sharedCaps) String() string {
+	return fmt.Sprint(*c)
+}
+
+func (c *sharedCaps) Set(s string) error {
+	pattern, size, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("want endpoint=rate, got %q", s)
+	}
+	rate, err := parseSize(size)
+	if err != nil {
+		return err
+	}
+	if rate <= 0 {
+		return fmt.Errorf("rate must be positive, got %q", size)
+	}
+	if *c == nil {
+		*c = make(sharedCaps)
+	}
+	(*c)[pattern] = &sharedBucket{rate: rate}
+	return nil
+}
+
+// sharedBandwidth wraps h so that what is written for each request,
+// including over hijacked connections, counts against the caps of its
+// endpoint in mux and the global cap.
+func sharedBandwidth(h http.Handler, mux *http.ServeMux, caps sharedCaps) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var bs []*sharedBucket
+		if b := caps[endpointName(mux, r)]; b != nil {
+			bs = append(bs, b)
+		}
+		if b := caps["*"]; b != nil {
+			bs = append(bs, b)
+		}
+		if len(bs) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		noteFault(r, "sharedBandwidth")
+		h.ServeHTTP(&sharedWriter{ResponseWriter: w, bs: bs}, r)
+	})
+}
+
+// sharedWrite writes p with write in pieces of a tenth of a second of the
+// smallest cap, waiting for each piece on every bucket in bs.
+func sharedWrite(bs []*sharedBucket, write func([]byte) (int, error), p []byte) (int, error) {
+	rate := bs[0].rate
+	for _, b := range bs[1:] {
+		rate = min(rate, b.rate)
+	}
+	chunk := max(int(rate/10), 1)
+	n := 0
+	for n < len(p) {
+		end := min(n+chunk, len(p))
+		for _, b := range bs {
+			b.wait(end - n)
+		}
+		nw, err := write(p[n:end])
+		n += nw
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+type sharedWriter struct {
+	http.ResponseWriter
+	bs []*sharedBucket
+}
+
+func (w *sharedWriter) Write(p []byte) (int, error) {
+	return sharedWrite(w.bs, w.ResponseWriter.Write, p)
+}
+
+func (w *sharedWriter) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *sharedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *sharedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c, brw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err != nil {
+		return c, brw, err
+	}
+	sc := &sharedConn{Conn: c, bs: w.bs}
+	brw.Writer.Reset(sc)
+	return sc, brw, nil
+}
+
+// sharedConn is a net.Conn whose writes count against shared caps.
+type sharedConn struct {
+	net.Conn
+	bs []*sharedBucket
+}
+
+func (c *sharedConn) Write(p []byte) (int, error) {
+	return sharedWrite(c.bs, c.Conn.Write, p)
+}
+
+func (c *sharedConn) NetConn() net.Conn {
+	return c.Conn
+}
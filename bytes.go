@@ -0,0 +1,82 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// seededBytes returns a reader of n bytes generated from seed, the same
+// bytes every time.
+func seededBytes(n, seed int64) io.Reader {
+	return io.LimitReader(rand.New(rand.NewSource(seed)), n)
+}
+
+// randomBytes serves /bytes/<n>: exactly n bytes of pseudo-random data
+// generated from the seed query param, 42 by default, so clients can check
+// what they received. chunked=true, or checksum=trailer, leaves out
+// Content-Length, rate caps the bytes sent per second and checksum and
+// badChecksum work as for /slow.
+func randomBytes(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	n, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/bytes/"), 10, 64)
+	if err != nil || n < 0 {
+		http.Error(w, "use /bytes/<n> with n a number of bytes", http.StatusBadRequest)
+		return
+	}
+	seed, err := strconv.ParseInt(q.Get("seed"), 10, 64)
+	if err != nil {
+		seed = 42
+	}
+	cs := newChecksum(q)
+	if cs.mode != "" {
+		io.Copy(cs, seededBytes(n, seed))
+		cs.announce(w)
+		defer cs.finish(w)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Seed", strconv.FormatInt(seed, 10))
+	// Trailers are only sent with chunked encoding.
+	if q.Get("chunked") != "true" && cs.mode != "trailer" {
+		w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	}
+	var dst io.Writer = w
+	if rate := sizeQueryParam(q, "rate", 0); rate > 0 {
+		s := &shaper{im: impairment{Bandwidth: rate}}
+		dst = writerFunc(func(p []byte) (int, error) {
+			n, err := s.write(w.Write, p)
+			w.(http.Flusher).Flush()
+			return n, err
+		})
+	}
+	io.Copy(dst, seededBytes(n, seed))
+}
+
+// writerFunc is an io.Writer calling itself.
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// infinite streams pseudo-random data without a Content-Length until the
+// client goes away, at rate bytes per second or as fast as possible if rate
+// is 0.
+func infinite(w http.ResponseWriter, r *http.Request) {
+	rate := sizeQueryParam(r.URL.Query(), "rate", 0)
+	noteFault(r, "infinite")
+	w.Header().Set("Content-Type", "application/octet-stream")
+	s := &shaper{im: impairment{Bandwidth: rate}}
+	buf := make([]byte, 32<<10)
+	rand.New(rand.NewSource(42)).Read(buf)
+	for r.Context().Err() == nil {
+		if _, err := s.write(w.Write, buf); err != nil {
+			return
+		}
+		w.(http.Flusher).Flush()
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cacheEpoch is when /cache resources were last modified unless a request
+// says otherwise, so that their validators are stable for the life of the
+// server.
+var cacheEpoch = time.Now().Truncate(time.Second)
+
+// cache serves a resource with Cache-Control, ETag and Last-Modified headers
+// and answers conditional requests according to the mode query param:
+//
+//	correct - 304 only when If-None-Match or If-Modified-Since match
+//	never   - always 200, ignoring the conditional headers
+//	always  - always 304 to conditional requests, even stale ones
+//	wrong   - 304 when validators match, with a different ETag than the 200
+//
+// The version query param changes the ETag, age sets Last-Modified that far
+// before the server started, cacheControl replaces the Cache-Control header
+// and delay and notModifiedDelay slow the 200 and 304 responses.
+func cache(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	version := q.Get("version")
+	h := fnv.New64a()
+	fmt.Fprint(h, r.URL.Path, version)
+	etag := fmt.Sprintf(`"%x"`, h.Sum64())
+	modified := cacheEpoch.Add(-timeQueryParam(q, "age", time.Hour))
+	cc := q.Get("cacheControl")
+	if cc == "" {
+		cc = fmt.Sprintf("max-age=%d", intQueryParam(q, "maxAge", 60))
+	}
+
+	conditional := r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+	var notModified bool
+	switch mode := q.Get("mode"); mode {
+	case "", "correct", "wrong":
+		notModified = cacheFresh(r, etag, modified)
+	case "never":
+	case "always":
+		notModified = conditional
+	default:
+		http.Error(w, "unknown mode "+mode, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Cache-Control", cc)
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	if notModified {
+		if q.Get("mode") == "wrong" {
+			etag = `"` + strings.Trim(etag, `"`) + `-wrong"`
+			noteFault(r, "cacheWrong")
+		}
+		w.Header().Set("ETag", etag)
+		time.Sleep(timeQueryParam(q, "notModifiedDelay", 0))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "text/plain")
+	time.Sleep(timeQueryParam(q, "delay", 0))
+	fmt.Fprintf(w, "%s version %q last modified %s\n", r.URL.Path, version, modified.UTC().Format(time.RFC3339))
+}
+
+// cacheFresh reports whether r's validators match etag and modified. As in
+// RFC 9110, If-Modified-Since is ignored when If-None-Match is present.
+func cacheFresh(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, t := range strings.Split(inm, ",") {
+			t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+			if t == "*" || t == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.After(t)
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"net/http"
+	"net/url"
+)
+
+// checksum emits a Content-Digest (RFC 9530) for the intended response body
+// so clients can verify they received all of it. The checksum query param
+// selects header or trailer delivery, and badChecksum=true deliberately sends
+// a wrong digest.
+type checksum struct {
+	hash.Hash
+	mode string
+	bad  bool
+}
+
+func newChecksum(v url.Values) *checksum {
+	return &checksum{
+		Hash: sha256.New(),
+		mode: v.Get("checksum"),
+		bad:  v.Get("badChecksum") == "true",
+	}
+}
+
+func (c *checksum) digest() string {
+	sum := c.Sum(nil)
+	if c.bad {
+		sum[0] ^= 0xff
+	}
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum) + ":"
+}
+
+// announce must be called before the response header is written, once the
+// whole intended body has been written to c.
+func (c *checksum) announce(w http.ResponseWriter) {
+	switch c.mode {
+	case "header":
+		w.Header().Set("Content-Digest", c.digest())
+	case "trailer":
+		w.Header().Set("Trailer", "Content-Digest")
+	}
+}
+
+// finish sets the trailer, if that is the selected mode.
+func (c *checksum) finish(w http.ResponseWriter) {
+	if c.mode == "trailer" {
+		w.Header().Set("Content-Digest", c.digest())
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config is a -f scenario file. Its settings are applied as if they were
+// the flags they stand for, except that flags on the command line win.
+// Scalars are kept as strings so that the flags parse them.
+type config struct {
+	URL            string            `yaml:"url"`
+	URLs           []string          `yaml:"urls"` // optionally weighted, "80:ws://host/ws-echo"
+	Mode           string            `yaml:"mode"`
+	Method         string            `yaml:"method"`
+	Headers        map[string]string `yaml:"headers"`
+	UserAgent      string            `yaml:"userAgent"`
+	Payload        string            `yaml:"payload"`
+	PayloadFile    string            `yaml:"payloadFile"`
+	Script         []string          `yaml:"script"`
+	Connections    string            `yaml:"connections"`
+	ConnectRate    string            `yaml:"connectRate"`
+	Duration       string            `yaml:"duration"`
+	Total          string            `yaml:"total"`
+	Messages       string            `yaml:"messages"`
+	RTT            string            `yaml:"rtt"`
+	Expect         string            `yaml:"expect"`
+	ExpectBytes    string            `yaml:"expectBytes"`
+	MaxErrorRate   string            `yaml:"maxErrorRate"`
+	MaxP99         string            `yaml:"maxP99"`
+	FailFast       string            `yaml:"failFast"`
+	Type           string            `yaml:"type"`
+	Size           string            `yaml:"size"`
+	Seed           string            `yaml:"seed"`
+	SendRate       string            `yaml:"sendRate"`
+	Interval       string            `yaml:"interval"`
+	Timeout        string            `yaml:"timeout"`
+	ConnectTimeout string            `yaml:"connectTimeout"`
+	Insecure       string            `yaml:"insecure"`
+	Resolve        string            `yaml:"resolve"`
+	Reconnect      string            `yaml:"reconnect"`
+	ReconnectDelay string            `yaml:"reconnectDelay"`
+	Cookies        string            `yaml:"cookies"`
+	Probe          string            `yaml:"probe"`
+	Profiles       string            `yaml:"profiles"`
+	ProfileDefs    []string          `yaml:"profileDefs"`
+	Stages         []string          `yaml:"stages"`
+	InstanceHeader string            `yaml:"instanceHeader"`
+	Output         string            `yaml:"output"`
+	Out            string            `yaml:"out"`
+}
+
+func loadConfig(file string) (*config, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var c config
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return &c, nil
+}
+
+// apply sets every flag c has a setting for, unless it was set on the
+// command line.
+func (c *config) apply() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	settings := []struct{ flag, value string }{
+		{"mode", c.Mode},
+		{"m", c.Method},
+		{"U", c.UserAgent},
+		{"d", c.Payload},
+		{"D", c.PayloadFile},
+		{"c", c.Connections},
+		{"q", c.ConnectRate},
+		{"z", c.Duration},
+		{"n", c.Total},
+		{"messages", c.Messages},
+		{"rtt", c.RTT},
+		{"expect", c.Expect},
+		{"expect-bytes", c.ExpectBytes},
+		{"max-error-rate", c.MaxErrorRate},
+		{"max-p99", c.MaxP99},
+		{"fail-fast", c.FailFast},
+		{"type", c.Type},
+		{"size", c.Size},
+		{"seed", c.Seed},
+		{"r", c.SendRate},
+		{"i", c.Interval},
+		{"t", c.Timeout},
+		{"connect-timeout", c.ConnectTimeout},
+		{"k", c.Insecure},
+		{"resolve", c.Resolve},
+		{"reconnect", c.Reconnect},
+		{"reconnect-delay", c.ReconnectDelay},
+		{"cookies", c.Cookies},
+		{"probe", c.Probe},
+		{"profiles", c.Profiles},
+		{"stages", strings.Join(c.Stages, ",")},
+		{"instance-header", c.InstanceHeader},
+		{"o", c.Output},
+		{"out", c.Out},
+	}
+	for _, s := range settings {
+		if s.value == "" || set[s.flag] {
+			continue
+		}
+		if err := flag.Set(s.flag, s.value); err != nil {
+			return fmt.Errorf("%s: %w", s.flag, err)
+		}
+	}
+	if !set["profile-def"] {
+		for _, d := range c.ProfileDefs {
+			flag.Set("profile-def", d)
+		}
+	}
+	return nil
+}
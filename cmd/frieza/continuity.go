@@ -0,0 +1,74 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// continuity tracks which backend instance each worker lands on, as reported
+// by a response header on the websocket handshake, so stickiness across
+// reconnects (e.g. through a rolling restart) can be quantified.
+type continuity struct {
+	header string
+
+	mu         sync.Mutex
+	last       map[int]string // last instance seen by each worker
+	reconnects int
+	same       int
+	switched   int
+	instances  map[string]int
+}
+
+func newContinuity(header string) *continuity {
+	return &continuity{
+		header:    header,
+		last:      make(map[int]string),
+		instances: make(map[string]int),
+	}
+}
+
+// record notes the instance worker i connected to.
+func (c *continuity) record(i int, h http.Header) {
+	id := h.Get(c.header)
+	if id == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.last[i]; ok {
+		c.reconnects++
+		if prev == id {
+			c.same++
+		} else {
+			c.switched++
+		}
+	}
+	c.last[i] = id
+	c.instances[id]++
+}
+
+func (c *continuity) PrintReport() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.instances) == 0 {
+		return
+	}
+	fmt.Printf("session continuity (%s): %d workers, %d reconnects, %d same instance, %d switched",
+		c.header, len(c.last), c.reconnects, c.same, c.switched)
+	if c.reconnects > 0 {
+		fmt.Printf(" (%.1f%% sticky)", 100*float64(c.same)/float64(c.reconnects))
+	}
+	fmt.Println()
+	ids := make([]string, 0, len(c.instances))
+	for id := range c.instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Printf("  %s: %d connections\n", id, c.instances[id])
+	}
+}
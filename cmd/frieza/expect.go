@@ -0,0 +1,28 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import "errors"
+
+var (
+	errUnexpectedContent = errors.New("unexpected content")
+	errUnexpectedSize    = errors.New("unexpected size")
+)
+
+// checking reports whether received messages, or response bodies in http
+// mode, are checked with -expect or -expect-bytes.
+func (w *Work) checking() bool {
+	return w.expect != nil || w.expectBytes > 0
+}
+
+// check returns an error if msg does not match -expect or is not
+// -expect-bytes long.
+func (w *Work) check(msg []byte) error {
+	if w.expectBytes > 0 && len(msg) != w.expectBytes {
+		return errUnexpectedSize
+	}
+	if w.expect != nil && !w.expect.Match(msg) {
+		return errUnexpectedContent
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// growth tracks the size of handshake request and response headers across
+// the reconnects of each worker, to show its cookies and headers
+// accumulating.
+type growth struct {
+	mu       sync.Mutex
+	workers  map[int]*workerGrowth
+	tooLarge map[int]int // 413 and 431 handshake failures
+}
+
+// workerGrowth follows the handshakes of one worker.
+type workerGrowth struct {
+	requests, replies trend
+}
+
+// trend follows a size across handshakes.
+type trend struct {
+	n, first, last, max int
+}
+
+func (t *trend) add(size int) {
+	if t.n == 0 {
+		t.first = size
+	}
+	t.n++
+	t.last = size
+	t.max = max(t.max, size)
+}
+
+func newGrowth() *growth {
+	return &growth{workers: make(map[int]*workerGrowth), tooLarge: make(map[int]int)}
+}
+
+// headerSize is the wire size of h, not counting the request or status line.
+func headerSize(h http.Header) int {
+	n := 0
+	for k, vs := range h {
+		for _, v := range vs {
+			n += len(k) + len(": ") + len(v) + len("\r\n")
+		}
+	}
+	return n
+}
+
+// requestSize estimates the handshake request header size for u, including
+// any cookies jar would send.
+func requestSize(h http.Header, jar http.CookieJar, u string) int {
+	n := headerSize(h)
+	if jar == nil {
+		return n
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return n
+	}
+	// The jar is keyed by http(s) URLs, as the dialer does.
+	switch pu.Scheme {
+	case "ws":
+		pu.Scheme = "http"
+	case "wss":
+		pu.Scheme = "https"
+	}
+	if cs := jar.Cookies(pu); len(cs) > 0 {
+		n += len("Cookie: \r\n")
+		for i, c := range cs {
+			if i > 0 {
+				n += len("; ")
+			}
+			n += len(c.String())
+		}
+	}
+	return n
+}
+
+// record notes one handshake of worker i. resp may be nil if the dial
+// failed early.
+func (g *growth) record(i, reqSize int, resp *http.Response) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	wg := g.workers[i]
+	if wg == nil {
+		wg = &workerGrowth{}
+		g.workers[i] = wg
+	}
+	wg.requests.add(reqSize)
+	if resp == nil {
+		return
+	}
+	wg.replies.add(headerSize(resp.Header))
+	switch resp.StatusCode {
+	case http.StatusRequestEntityTooLarge, http.StatusRequestHeaderFieldsTooLarge:
+		g.tooLarge[resp.StatusCode]++
+	}
+}
+
+// trendSummary is the mean of the trends of all workers which had one, and
+// the largest size any of them saw.
+type trendSummary struct {
+	workers, reconnecting int
+	first, last           float64
+	max                   int
+	perHandshake          float64 // mean growth per reconnect of workers which reconnected
+	grew                  bool
+}
+
+func (g *growth) summarize(get func(*workerGrowth) *trend) trendSummary {
+	var s trendSummary
+	for _, wg := range g.workers {
+		t := get(wg)
+		if t.n == 0 {
+			continue
+		}
+		s.workers++
+		s.first += float64(t.first)
+		s.last += float64(t.last)
+		s.max = max(s.max, t.max)
+		s.grew = s.grew || t.max > t.first
+		if t.n > 1 {
+			s.reconnecting++
+			s.perHandshake += float64(t.last-t.first) / float64(t.n-1)
+		}
+	}
+	if s.workers > 0 {
+		s.first /= float64(s.workers)
+		s.last /= float64(s.workers)
+	}
+	if s.reconnecting > 0 {
+		s.perHandshake /= float64(s.reconnecting)
+	}
+	return s
+}
+
+func (s trendSummary) print(name string) {
+	fmt.Printf("handshake %s headers per worker: first %.0f bytes, last %.0f, max %d", name, s.first, s.last, s.max)
+	if s.reconnecting > 0 {
+		fmt.Printf(", %+.1f bytes per handshake", s.perHandshake)
+	}
+	fmt.Println()
+}
+
+func (g *growth) PrintReport() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	requests := g.summarize(func(wg *workerGrowth) *trend { return &wg.requests })
+	replies := g.summarize(func(wg *workerGrowth) *trend { return &wg.replies })
+	// Stay quiet unless something grew or was rejected for its size.
+	if !requests.grew && !replies.grew && len(g.tooLarge) == 0 {
+		return
+	}
+	requests.print("request")
+	if replies.workers > 0 {
+		replies.print("response")
+	}
+	for code, n := range g.tooLarge {
+		fmt.Printf("  %d %s: %d\n", code, http.StatusText(code), n)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// setupHTTP prepares the client used by workers in http mode.
+func (w *Work) setupHTTP() {
+	d := &net.Dialer{Timeout: w.ct}
+	tr := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         d.DialContext,
+		TLSHandshakeTimeout: w.ct,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: w.k,
+		},
+		MaxIdleConnsPerHost: w.C,
+	}
+	if w.ao != nil {
+		tr.DialContext = w.ao.DialContext
+	}
+	w.client = &http.Client{
+		Transport: tr,
+		Timeout:   time.Duration(w.Timeout) * time.Second,
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+}
+
+// runHTTPWorker makes requests one after the other for worker i until the
+// work is stopped or quit is closed.
+func (w *Work) runHTTPWorker(i int, quit <-chan struct{}) {
+	c := &counter{profile: w.profileFor(i), target: w.targetFor(i)}
+	w.mu.Lock()
+	w.counters = append(w.counters, c)
+	w.mu.Unlock()
+	client := w.client
+	if w.cookies {
+		cc := *w.client
+		cc.Jar, _ = cookiejar.New(nil)
+		client = &cc
+	}
+	rec := w.newRecord(i, c)
+	defer w.finishRecord(rec, c, nil)
+	var p *pacer
+	if w.sendRate > 0 {
+		p = newPacer(w.sendRate)
+	}
+	for !w.stopped() && !retired(quit) && w.claim() {
+		if p != nil && !p.wait(w.stopCh) {
+			return
+		}
+		err := w.request(i, c, client, w.payload(i, int64(rec.Requests)))
+		if w.stopped() {
+			return
+		}
+		rec.Requests++
+		if err != nil {
+			rec.Errors++
+			if w.verbose {
+				log.Print("request ", i, " failed: ", err)
+			}
+		}
+	}
+}
+
+// request makes a single request with body for worker i and reads the whole
+// response.
+func (w *Work) request(i int, c *counter, client *http.Client, body string) error {
+	req, err := http.NewRequestWithContext(w.ctx, w.method, c.target.URL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = w.header.Clone()
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		if !w.stopped() {
+			w.stats.error(err, nil)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	var out io.Writer = c
+	if w.vv {
+		out = io.MultiWriter(os.Stdout, c)
+	}
+	var n int64
+	var msg []byte
+	if w.checking() {
+		msg, err = io.ReadAll(resp.Body)
+		out.Write(msg)
+		n = int64(len(msg))
+	} else {
+		n, err = io.Copy(out, resp.Body)
+	}
+	if err != nil {
+		if !w.stopped() {
+			w.stats.error(err, nil)
+		}
+		return err
+	}
+	w.stats.responded(resp.StatusCode, time.Since(start))
+	if w.checking() {
+		if err := w.check(msg); err != nil {
+			w.stats.error(err, nil)
+			return err
+		}
+	}
+	if w.verbose {
+		log.Print("worker ", i, " got ", resp.Status, " and ", n, " bytes")
+	}
+	return nil
+}
+
+// probeHTTP makes a single request to u, failing if it cannot be reached or
+// the path does not exist. Other statuses are only reported, as plenty of
+// targets fail on purpose.
+func (w *Work) probeHTTP(u string) error {
+	req, err := http.NewRequest(w.method, u, strings.NewReader(w.payload(0, 0)))
+	if err != nil {
+		return err
+	}
+	req.Header = w.header.Clone()
+	start := time.Now()
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not connect: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("request rejected with %s: the path does not exist on the target", resp.Status)
+	}
+	if w.verbose {
+		fmt.Println("probe got", resp.Status, "in", time.Since(start))
+		for k, v := range resp.Header {
+			fmt.Println("  ", k+":", v)
+		}
+	}
+	return nil
+}
+
+// printHTTPReport prints request totals, the status codes seen and the most
+// frequent errors.
+func (w *Work) printHTTPReport(bytes int) {
+	s := w.stats
+	_, _, requests := s.latencies()
+	s.mu.Lock()
+	codes := make([]int, 0, len(s.statuses))
+	for code := range s.statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	fmt.Println(requests.n, "requests,", bytes, "bytes read by", w.C, "workers")
+	for _, code := range codes {
+		fmt.Printf("  [%d] %d responses\n", code, s.statuses[code])
+	}
+	s.mu.Unlock()
+	for _, e := range s.topErrors(5) {
+		fmt.Printf("  %d errors: %s\n", e.n, e.category)
+	}
+	printLatencies("request", requests)
+}
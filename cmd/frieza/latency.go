@@ -0,0 +1,152 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	histogramBuckets = 10
+	histogramWidth   = 40
+)
+
+// durations counts durations in fixed log-scale buckets, so that recording
+// takes the same memory however long a run is. The count, mean, min and max
+// are exact, percentiles are accurate to about 2%.
+type durations struct {
+	n        int
+	sum      time.Duration
+	min, max time.Duration
+	counts   []int // by bucket, allocated by the first add
+}
+
+// Bucket 0 holds durations up to durationsBase, bucket i > 0 those over
+// durationsBase*durationsGrowth^(i-1) up to durationsBase*durationsGrowth^i.
+// The last bucket also holds anything longer, over an hour.
+const (
+	durationsBase    = time.Microsecond
+	durationsGrowth  = 1.04
+	durationsBuckets = 560
+)
+
+func bucketOf(d time.Duration) int {
+	if d <= durationsBase {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(durationsBase)) / math.Log(durationsGrowth)))
+	return min(i, durationsBuckets-1)
+}
+
+// value is the middle of bucket i, kept within the durations seen.
+func (ds *durations) value(i int) time.Duration {
+	v := durationsBase
+	if i > 0 {
+		v = time.Duration(float64(durationsBase) * math.Pow(durationsGrowth, float64(i)-0.5))
+	}
+	return min(max(v, ds.min), ds.max)
+}
+
+func (ds *durations) add(d time.Duration) {
+	if ds.counts == nil {
+		ds.counts = make([]int, durationsBuckets)
+	}
+	if ds.n == 0 || d < ds.min {
+		ds.min = d
+	}
+	if ds.n == 0 || d > ds.max {
+		ds.max = d
+	}
+	ds.n++
+	ds.sum += d
+	ds.counts[bucketOf(d)]++
+}
+
+func (ds *durations) clone() *durations {
+	c := *ds
+	c.counts = slices.Clone(ds.counts)
+	return &c
+}
+
+// latencySummary describes a set of latencies.
+type latencySummary struct {
+	N                             int
+	Min, Mean, P50, P90, P99, Max time.Duration
+}
+
+// summarize describes ds.
+func summarize(ds *durations) latencySummary {
+	s := latencySummary{N: ds.n}
+	if ds.n == 0 {
+		return s
+	}
+	s.Min, s.Max = ds.min, ds.max
+	s.Mean = ds.sum / time.Duration(ds.n)
+	s.P50 = ds.percentile(50)
+	s.P90 = ds.percentile(90)
+	s.P99 = ds.percentile(99)
+	return s
+}
+
+// percentile returns the p-th percentile of ds by the nearest rank method.
+func (ds *durations) percentile(p int) time.Duration {
+	rank := max((ds.n*p+99)/100, 1)
+	for i, n := range ds.counts {
+		if rank -= n; rank <= 0 {
+			return ds.value(i)
+		}
+	}
+	return ds.max
+}
+
+// histogram counts ds in histogramBuckets buckets of equal width from the
+// smallest to the largest, returning the upper bound and count of each
+// bucket.
+func histogram(ds *durations) ([]time.Duration, []int) {
+	if ds.n == 0 {
+		return nil, nil
+	}
+	lo, hi := ds.min, ds.max
+	width := (hi - lo) / histogramBuckets
+	bounds := make([]time.Duration, histogramBuckets)
+	counts := make([]int, histogramBuckets)
+	for i := range bounds {
+		bounds[i] = lo + width*time.Duration(i+1)
+	}
+	bounds[len(bounds)-1] = hi
+	b := 0
+	for i, n := range ds.counts {
+		if n == 0 {
+			continue
+		}
+		for ds.value(i) > bounds[b] {
+			b++
+		}
+		counts[b] += n
+	}
+	return bounds, counts
+}
+
+// printLatencies prints a summary and histogram of ds under name.
+func printLatencies(name string, ds *durations) {
+	s := summarize(ds)
+	if s.N == 0 {
+		return
+	}
+	r := func(d time.Duration) time.Duration { return d.Round(time.Microsecond) }
+	fmt.Printf("%s latency (%d): min %s  mean %s  p50 %s  p90 %s  p99 %s  max %s\n",
+		name, s.N, r(s.Min), r(s.Mean), r(s.P50), r(s.P90), r(s.P99), r(s.Max))
+	bounds, counts := histogram(ds)
+	most := slices.Max(counts)
+	for i, n := range counts {
+		bar := n * histogramWidth / most
+		if n > 0 && bar == 0 {
+			bar = 1
+		}
+		fmt.Printf("  %10s [%d]\t|%s\n", r(bounds[i]), n, strings.Repeat("■", bar))
+	}
+}
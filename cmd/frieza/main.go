@@ -16,17 +16,21 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/http/cookiejar"
 	"os"
 	"os/signal"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -40,39 +44,123 @@ const (
 )
 
 // Yes, ths is copied from hey, becuase it would be nice to use the same flags.
-var usage = `Usage: frieza [options...] <url>
+var usage = `Usage: frieza [options...] <url> [<url>...]
+
+Workers are spread across several urls by weight, given as a prefix such as
+80:ws://host/ws-echo 20:ws://host/ws-pinger. Urls without one weigh 1.
+
 Options:
+  -f  YAML scenario file with the settings of a run, see README.md. Flags
+      given on the command line override it.
   -c  Number of connections to make. Default is 50.
-  -q  Rate limit, in connections per second (CPS). Default is no rate limit.
+  -q  Rate limit, in connections per second (CPS), paced evenly. May be
+      fractional, -q 0.5 connects every two seconds. Default is to start
+      all connections over one second.
+  -stages  Change the number of workers over time instead of starting -c
+      workers, e.g. "ramp:0-500c/2m,hold:5m,ramp:500-0c/1m". A ramp without
+      a start, "ramp:100c/30s", starts where the previous stage ended. The
+      run stops after the last stage unless -z is shorter. Workers whose
+      websocket closes are not replaced unless -reconnect is set.
+  -n  Number of connections to make in total, counting reconnects, after which
+      the run stops. In http mode, number of requests. Default is no limit.
+  -messages  Close each websocket after receiving this many messages.
   -z  Duration of application to send requests. When duration is reached,
       application stops and exits. Default is 5m.
       Examples: -z 10s -z 3m -z 1h.
   -H  Custom HTTP header. You can specify as many as needed by repeating the flag.
       For example, -H "Accept: text/html" -H "Content-Type: application/xml" .
   -k  Allow insecure connections when using TLS.
-  -d  data to send on websocket.
+  -d  data to send on websocket, or HTTP request body in http mode. It may
+      be a template expanded for every message, using {{.WorkerID}},
+      {{.Seq}}, {{.TimestampNano}} and {{.RandAlpha 32}}.
   -D  data to send on websocket from file. For example, /home/user/file.txt or ./file.txt.
+  -r  Messages per second each worker sends the -d or -D payload at, instead
+      of once. May be fractional. In http mode, requests per second per worker.
+  -i  Interval between messages each worker sends, an alternative to -r.
+      For example, -i 500ms.
+  -rtt  Put a line "frieza-rtt <seq> <unix nanoseconds>" in front of every
+      websocket message sent and report the round trip times of the ones
+      echoed back, for use with echo endpoints. -expect and -expect-bytes
+      check echoes without the line.
+  -expect  Regular expression every message received, or response body in
+      http mode, must match. Mismatches are counted as errors.
+  -expect-bytes  Size every message received, or response body in http
+      mode, must be. Mismatches are counted as errors.
+  -max-error-rate  Exit with status 2 if errors are more than this share of
+      connections, messages received and requests, e.g. 1% or 0.01.
+      Responses with a 4xx or 5xx status count as errors.
+  -max-p99  Exit with status 2 if the 99th percentile latency is over this,
+      e.g. 500ms. It is of requests in http mode, otherwise of round trips
+      with -rtt and of handshakes without.
+  -fail-fast  Stop the run as soon as -max-error-rate or -max-p99 is
+      breached, checking every second.
+  -type  Websocket message type to send, text, binary, the default, or ping.
+      Pings carry the payload, which must then be at most 125 bytes once
+      expanded, and are not echoed, so cannot be used with -rtt, -expect,
+      -expect-bytes or -messages.
+  -size  Send this many pseudo-random bytes instead of -d or -D, letters and
+      digits with -type text.
+  -seed  Seed of the -size payload, the same seed giving the same payload.
+      Default is 1.
+  -mode  ws to load websockets, the default, or http to make plain HTTP
+      requests, each worker making one request after another.
+  -m  HTTP method in http mode, one of GET, POST, PUT, DELETE, HEAD, OPTIONS.
+      Default is GET.
+  -t  Timeout for each request in http mode, in seconds. Default is 20.
   -connect-timeout  Connect (websocket handshake) timeout.
   -U  User-Agent, defaults to version "frieza/0.0.1".
   -v  Verbose output.
   -vv Very verbose output.
   -resolve <host:port:addr[,addr]...> Use custom addr to override DNS.
   -host	HTTP Host header -- not implemented -- use -resolve
+  -reconnect  Redial when a websocket is closed before the run is stopped.
+  -reconnect-delay  Delay before redialing. Default is 1s.
+  -probe  Make a single sanity probe connection before starting the run and
+      abort if the target is obviously misconfigured. Default is true,
+      disable with -probe=false.
+  -cookies  Keep a cookie jar per worker and send its cookies when reconnecting.
+      Handshake header growth is reported either way.
+  -profiles  Assign workers to client profiles by weight, e.g. "mobile=70,desktop=30".
+      Built in profiles are mobile, desktop, iot and idle.
+  -profile-def  Define a client profile, e.g. "slowphone=rate:0.5,size:100,read:2048,ping:15s"
+      where rate is messages sent per second, size the message size, read the
+      bytes read per second and ping the ping interval. May be repeated.
+  -o  Report format, text, the default, json or csv. The json and csv reports
+      have a row per websocket connection, or per worker in http mode, and
+      a summary.
+  -out  Write the -o report to a file instead of stdout, printing the text
+      report as well.
+  -tui  Show a live dashboard instead of scrolling output.
+  -instance-header  Response header identifying the backend instance, used to
+      report session continuity across reconnects. Default is X-Instance-Id.
 `
 
 func main() {
 	var body, bodyFile, hostHeader, userAgent string
-	var resolve string
-	var conc, t, q int
-	var dur, connectTimeout time.Duration
-	var k, h2, v, vv bool
+	var resolve, instanceHeader, profiles, mode, method string
+	var output, outFile, stagesSpec, configFile, expectPattern, maxErrorRate, msgType string
+	var conc, t, n, messages, expectBytes, size int
+	var seed int64
+	var q, rate float64
+	var dur, connectTimeout, reconnectDelay, interval, maxP99 time.Duration
+	var k, h2, v, vv, reconnect, tui, probe, cookies, rtt, failFast bool
 	flag.StringVar(&body, "d", "", "")
 	flag.StringVar(&bodyFile, "D", "", "")
 	flag.StringVar(&hostHeader, "host", "", "")
 	flag.StringVar(&userAgent, "U", ua, "")
+	flag.StringVar(&mode, "mode", "ws", "")
+	flag.StringVar(&method, "m", http.MethodGet, "")
+	flag.StringVar(&output, "o", "text", "")
+	flag.StringVar(&outFile, "out", "", "")
+	flag.StringVar(&stagesSpec, "stages", "", "")
+	flag.StringVar(&configFile, "f", "", "")
 
 	flag.IntVar(&conc, "c", 50, "")
-	flag.IntVar(&q, "q", 0, "")
+	flag.IntVar(&n, "n", 0, "")
+	flag.IntVar(&messages, "messages", 0, "")
+	flag.Float64Var(&q, "q", 0, "")
+	flag.Float64Var(&rate, "r", 0, "")
+	flag.DurationVar(&interval, "i", 0, "")
 	flag.IntVar(&t, "t", 20, "")
 	flag.DurationVar(&dur, "z", 5*time.Minute, "")
 	flag.BoolVar(&h2, "h2", false, "")
@@ -80,6 +168,24 @@ func main() {
 	flag.BoolVar(&vv, "vv", false, "")
 	flag.BoolVar(&k, "k", false, "")
 	flag.DurationVar(&connectTimeout, "connect-timeout", 5*time.Second, "")
+	flag.BoolVar(&reconnect, "reconnect", false, "")
+	flag.BoolVar(&tui, "tui", false, "")
+	flag.BoolVar(&probe, "probe", true, "")
+	flag.BoolVar(&cookies, "cookies", false, "")
+	flag.BoolVar(&rtt, "rtt", false, "")
+	flag.StringVar(&expectPattern, "expect", "", "")
+	flag.IntVar(&expectBytes, "expect-bytes", 0, "")
+	flag.StringVar(&maxErrorRate, "max-error-rate", "", "")
+	flag.DurationVar(&maxP99, "max-p99", 0, "")
+	flag.BoolVar(&failFast, "fail-fast", false, "")
+	flag.StringVar(&msgType, "type", "binary", "")
+	flag.IntVar(&size, "size", 0, "")
+	flag.Int64Var(&seed, "seed", 1, "")
+	flag.StringVar(&profiles, "profiles", "", "")
+	var profileDefs headerSlice
+	flag.Var(&profileDefs, "profile-def", "")
+	flag.DurationVar(&reconnectDelay, "reconnect-delay", time.Second, "")
+	flag.StringVar(&instanceHeader, "instance-header", "X-Instance-Id", "")
 
 	flag.StringVar(&resolve, "resolve", "", "")
 	flag.Usage = func() {
@@ -90,17 +196,111 @@ func main() {
 	flag.Var(&hs, "H", "")
 
 	flag.Parse()
-	if flag.NArg() < 1 {
+	cfg := &config{}
+	if configFile != "" {
+		var err error
+		if cfg, err = loadConfig(configFile); err != nil {
+			usageAndExit(err.Error())
+		}
+		if err := cfg.apply(); err != nil {
+			usageAndExit(configFile + ": " + err.Error())
+		}
+	}
+	urls := flag.Args()
+	if len(urls) == 0 {
+		urls = cfg.URLs
+		if cfg.URL != "" {
+			urls = append([]string{cfg.URL}, urls...)
+		}
+	}
+	if len(urls) == 0 {
 		usageAndExit("")
 	}
+	targets, err := parseTargets(urls)
+	if err != nil {
+		usageAndExit(err.Error())
+	}
 
 	if q == 0 {
-		q = conc
+		q = float64(conc)
+	}
+	if n < 0 || messages < 0 || expectBytes < 0 {
+		usageAndExit("-n, -messages and -expect-bytes must not be negative")
+	}
+	limits := slo{maxP99: maxP99}
+	if maxErrorRate != "" {
+		if limits.maxErrorRate, err = parseRate(maxErrorRate); err != nil || limits.maxErrorRate <= 0 {
+			usageAndExit("-max-error-rate must be a positive rate such as 1% or 0.01")
+		}
+	}
+	var expect *regexp.Regexp
+	if expectPattern != "" {
+		if expect, err = regexp.Compile(expectPattern); err != nil {
+			usageAndExit("-expect: " + err.Error())
+		}
+	}
+	if q < 0 {
+		usageAndExit("-q must not be negative")
+	}
+
+	if mode != "ws" && mode != "http" {
+		usageAndExit("-mode must be ws or http")
+	}
+	switch {
+	case rate < 0 || interval < 0:
+		usageAndExit("-r and -i must not be negative")
+	case rate > 0 && interval > 0:
+		usageAndExit("use -r or -i, not both")
+	case interval > 0:
+		rate = float64(time.Second) / float64(interval)
+	}
+	var stages []stage
+	if stagesSpec != "" {
+		var err error
+		if stages, err = parseStages(stagesSpec); err != nil {
+			usageAndExit(err.Error())
+		}
+		conc = peakWorkers(stages)
+		// The stages say how long to run, so only an explicit -z cuts them short.
+		zSet := false
+		flag.Visit(func(f *flag.Flag) { zSet = zSet || f.Name == "z" })
+		if !zSet {
+			dur = 0
+		}
+	}
+	if output != "text" && output != "json" && output != "csv" {
+		usageAndExit("-o must be text, json or csv")
+	}
+	if bodyFile != "" {
+		b, err := os.ReadFile(bodyFile)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		body = string(b)
+	}
+	switch {
+	case size < 0:
+		usageAndExit("-size must not be negative")
+	case size > 0 && body != "":
+		usageAndExit("use -size or -d/-D, not both")
+	case size > 0:
+		body = randomPayload(size, seed, msgType == "text")
+	}
+	switch msgType {
+	case "text", "binary":
+	case "ping":
+		if rtt || expectPattern != "" || expectBytes > 0 || messages > 0 {
+			usageAndExit("pings are not echoed as messages, so -type ping cannot be used with -rtt, -expect, -expect-bytes or -messages")
+		}
+	default:
+		usageAndExit("-type must be text, binary or ping")
 	}
 
-	url := flag.Arg(0)
 	// set content-type
 	header := make(http.Header)
+	for k, v := range cfg.Headers {
+		header.Set(k, v)
+	}
 	for _, h := range hs {
 		match, err := parseInputWithRegexp(h, headerRegexp)
 		if err != nil {
@@ -110,17 +310,74 @@ func main() {
 	}
 	header.Set("user-agent", userAgent)
 
+	var ps []*clientProfile
+	if profiles != "" {
+		var err error
+		if ps, err = parseProfiles(profiles, profileDefs); err != nil {
+			usageAndExit(err.Error())
+		}
+	}
+
 	w := &Work{
-		URL:     url,
-		C:       conc,
-		CPS:     q,
-		Timeout: t,
-		resolve: resolve,
-		verbose: v,
-		vv:      vv,
-		header:  header,
-		k:       k,
-		ct:      connectTimeout,
+		targets:  targets,
+		N:        n,
+		C:        conc,
+		CPS:      q,
+		Timeout:  t,
+		SendData: body,
+		resolve:  resolve,
+		verbose:  v,
+		vv:       vv,
+		header:   header,
+		k:        k,
+		ct:       connectTimeout,
+		mode:     mode,
+		sendRate: rate,
+		messages: messages,
+		stages:   stages,
+		rtt:      rtt,
+
+		expect:      expect,
+		expectBytes: expectBytes,
+		slo:         limits,
+		msgType:     msgType,
+		random:      size > 0,
+		script:      cfg.Script,
+		method:      strings.ToUpper(method),
+
+		reconnect:      reconnect,
+		reconnectDelay: reconnectDelay,
+		continuity:     newContinuity(instanceHeader),
+		stats:          newStats(),
+		growth:         newGrowth(),
+		cookies:        cookies,
+		profiles:       ps,
+	}
+	if err := w.compilePayloads(); err != nil {
+		usageAndExit("payload template: " + err.Error())
+	}
+	if msgType == "ping" {
+		// Templates may still expand to longer pings later, which send
+		// refuses.
+		for k := 0; k < max(len(w.script), 1); k++ {
+			if len(w.payload(0, int64(k))) > maxPingPayload {
+				usageAndExit(errPingTooLong.Error())
+			}
+		}
+	}
+	w.setup()
+	if probe {
+		if err := w.probe(); err != nil {
+			fmt.Fprintln(os.Stderr, "sanity probe failed:", err)
+			os.Exit(1)
+		}
+	}
+	w.started = time.Now()
+	if tui {
+		if !v && !vv {
+			log.SetOutput(io.Discard)
+		}
+		go w.runTUI()
 	}
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
@@ -128,62 +385,142 @@ func main() {
 		<-c
 		w.Stop()
 	}()
-	go func() {
-		time.Sleep(dur)
-		w.Stop()
-	}()
+	if dur > 0 {
+		go func() {
+			time.Sleep(dur)
+			w.Stop()
+		}()
+	}
+	if failFast {
+		go w.failFast()
+	}
 	w.Start()
-	w.PrintReport()
+	if output == "text" || outFile != "" {
+		w.PrintReport()
+	}
+	if output != "text" {
+		out := os.Stdout
+		if outFile != "" {
+			f, err := os.Create(outFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			out = f
+		}
+		if err := w.writeReport(out, output); err != nil {
+			log.Fatal(err)
+		}
+		if err := out.Close(); err != nil && outFile != "" {
+			log.Fatal(err)
+		}
+	}
+	if b := w.breached(); b != "" {
+		fmt.Fprintln(os.Stderr, "SLO breached:", b)
+		os.Exit(sloExitCode)
+	}
 }
 
 type Work struct {
 	// TODO: Unexport everything.
 	N        int
 	C        int
-	CPS      int
+	CPS      float64
 	Timeout  int
-	URL      string
+	targets  []*target
 	resolve  string
 	SendData string
 	started  time.Time
-	stopped  time.Time
+	finished time.Time
 	verbose  bool
 	vv       bool
 	k        bool
-	sockets  chan *websocket.Conn
-	counters chan *counter
 	ao       *res.Override
 	dila     *websocket.Dialer
 	ct       time.Duration
 	header   http.Header
 	stopCh   chan struct{}
+	stopOnce sync.Once
+
+	mode   string // ws or http
+	method string
+	client *http.Client
+	ctx    context.Context // cancelled by Stop, for http requests
+	cancel context.CancelFunc
+
+	sendRate    float64 // messages or requests per second per worker, 0 sends once
+	messages    int     // received before closing a websocket, 0 is unlimited
+	claimed     int64   // connections or requests counted against N
+	running     int64   // workers running, updated atomically
+	stages      []stage
+	rtt         bool               // stamp messages sent and time their echoes
+	msgType     string             // text, binary or ping
+	script      []string           // payloads sent in turn instead of SendData
+	random      bool               // SendData is from -size, not a template
+	sendTmpl    *template.Template // SendData, if it is a template
+	scriptTmpls []*template.Template
+
+	expect      *regexp.Regexp // received messages must match, if set
+	expectBytes int            // received messages must be this long, if set
+	slo         slo
+
+	reconnect      bool
+	reconnectDelay time.Duration
+	continuity     *continuity
+	stats          *stats
+	growth         *growth
+	cookies        bool
+	profiles       []*clientProfile
+
+	mu       sync.Mutex
+	sockets  map[*websocket.Conn]<-chan struct{} // to the quit channel of their worker
+	counters []*counter
+	records  []*connRecord
 }
 
 func (w *Work) PrintReport() {
 	// TODO: Report more stats.
 	var total int
-	for c := range w.counters {
-		total += c.N
+	w.mu.Lock()
+	for _, c := range w.counters {
+		total += c.read()
 	}
-	fmt.Println(total, "bytes read from", w.C, "websockets")
+	w.mu.Unlock()
+	if w.mode == "http" {
+		w.printHTTPReport(total)
+	} else {
+		fmt.Println(total, "bytes read from", w.C, "websockets")
+		handshakes, messages, _ := w.stats.latencies()
+		printLatencies("handshake", handshakes)
+		printLatencies("message", messages)
+		printLatencies("round trip", w.stats.roundTrips())
+	}
+	w.printTargetReport()
+	w.continuity.PrintReport()
+	w.growth.PrintReport()
+	w.printProfileReport()
 }
 
 func (w *Work) Stop() {
+	w.stopOnce.Do(w.stop)
+}
+
+func (w *Work) stop() {
 	if w.verbose {
 		fmt.Println("stopping")
 	}
-	// This could block if any worker returned already from error :(
-	for i := 0; i < w.C; i++ {
-		w.stopCh <- struct{}{}
+	close(w.stopCh)
+	if w.cancel != nil {
+		w.cancel()
 	}
-	close(w.sockets)
-	close(w.counters)
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	for s := range w.sockets {
-		err := s.WriteMessage(websocket.CloseMessage,
-			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		// WriteControl, unlike WriteMessage, is safe alongside a sendLoop.
+		err := s.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(w.ct))
 		if err != nil {
 			log.Println("write close:", err)
-			return
+			continue
 		}
 		// s.Close() // Close the underlying socket, not sure if I should.
 	}
@@ -192,10 +529,45 @@ func (w *Work) Stop() {
 	}
 }
 
-func (w *Work) Start() {
-	w.sockets = make(chan *websocket.Conn, w.C)
-	w.counters = make(chan *counter, w.C)
-	w.stopCh = make(chan struct{}, w.C)
+// maxPingPayload is the most a ping, like any control frame, may carry.
+const maxPingPayload = 125
+
+var errPingTooLong = fmt.Errorf("-type ping payloads must be at most %d bytes", maxPingPayload)
+
+// send sends payload on ws as a message of -type.
+func (w *Work) send(ws *websocket.Conn, payload []byte) error {
+	switch w.msgType {
+	case "text":
+		return ws.WriteMessage(websocket.TextMessage, payload)
+	case "ping":
+		if len(payload) > maxPingPayload {
+			return errPingTooLong
+		}
+		return ws.WriteControl(websocket.PingMessage, payload, time.Now().Add(w.ct))
+	}
+	return ws.WriteMessage(websocket.BinaryMessage, payload)
+}
+
+// claim reports whether another connection, or request in http mode, may be
+// made without exceeding N.
+func (w *Work) claim() bool {
+	return w.N == 0 || atomic.AddInt64(&w.claimed, 1) <= int64(w.N)
+}
+
+// stopped reports whether Stop has been called.
+func (w *Work) stopped() bool {
+	select {
+	case <-w.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// setup prepares w to be started. It must be called before anything else.
+func (w *Work) setup() {
+	w.sockets = make(map[*websocket.Conn]<-chan struct{})
+	w.stopCh = make(chan struct{})
 	w.dila = &websocket.Dialer{
 		Proxy:            http.ProxyFromEnvironment,
 		HandshakeTimeout: w.ct,
@@ -212,85 +584,206 @@ func (w *Work) Start() {
 		w.ao = &res.Override{H: host, Addrs: addrs}
 		w.dila.NetDialContext = w.ao.DialContext
 	}
-	w.started = time.Now()
+	if w.mode == "http" {
+		w.setupHTTP()
+	}
+}
+
+func (w *Work) Start() {
+	if w.stages != nil {
+		w.runStages()
+		return
+	}
 	var wg sync.WaitGroup
-	wg.Add(w.C)
-	for i := 0; i < w.C; i++ {
+	p := newPacer(w.CPS)
+	i := 0
+	for ; i < w.C && p.wait(w.stopCh); i++ {
+		wg.Add(1)
 		go func(i int) {
-			w.runWorker(i)
+			w.run(i, nil)
 			wg.Done()
 		}(i)
-		if i > 0 && i%w.CPS == 0 {
-			if w.verbose {
-				fmt.Println(i, "workers started")
-			}
+		if w.verbose && i > 0 && i%max(int(w.CPS), 1) == 0 {
+			fmt.Println(i, "workers started")
 		}
-		// This is a very naive attempt at CPS.
-		// TODO: Ramp up better.
-		time.Sleep(time.Duration(1 * int(time.Second) / w.CPS))
 	}
 	if w.verbose {
-		fmt.Println(w.C, "workers started")
+		fmt.Println(i, "workers started")
 	}
 	wg.Wait()
-	w.stopped = time.Now()
+	w.finished = time.Now()
+}
+
+// run runs worker i until the work is stopped or quit is closed.
+func (w *Work) run(i int, quit <-chan struct{}) {
+	atomic.AddInt64(&w.running, 1)
+	defer atomic.AddInt64(&w.running, -1)
+	if w.mode == "http" {
+		w.runHTTPWorker(i, quit)
+	} else {
+		w.runWorker(i, quit)
+	}
+}
+
+// retired reports whether quit is closed.
+func retired(quit <-chan struct{}) bool {
+	select {
+	case <-quit:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Work) runWorker(i int, quit <-chan struct{}) {
+	c := &counter{profile: w.profileFor(i), target: w.targetFor(i)}
+	w.mu.Lock()
+	w.counters = append(w.counters, c)
+	w.mu.Unlock()
+	d := w.dila
+	if w.cookies {
+		// Each worker is its own client with its own cookies.
+		dd := *w.dila
+		dd.Jar, _ = cookiejar.New(nil)
+		d = &dd
+	}
+	for !retired(quit) && w.claim() {
+		rec := w.newRecord(i, c)
+		err := w.runConn(i, c, d, rec, quit)
+		if retired(quit) {
+			err = nil
+		}
+		w.finishRecord(rec, c, err)
+		if !w.reconnect || w.stopped() {
+			return
+		}
+		if w.verbose {
+			log.Print("websocket ", i, " reconnecting after: ", err)
+		}
+		select {
+		case <-w.stopCh:
+			return
+		case <-time.After(w.reconnectDelay):
+		}
+	}
 }
 
-func (w *Work) runWorker(i int) {
-	ws, resp, err := w.dila.Dial(w.URL, w.header)
+// runConn dials a single websocket for worker i using d and reads from it until it
+// fails, the work is stopped or quit is closed, noting the handshake and messages
+// in rec.
+func (w *Work) runConn(i int, c *counter, d *websocket.Dialer, rec *connRecord, quit <-chan struct{}) error {
+	reqSize := requestSize(w.header, d.Jar, c.target.URL)
+	start := time.Now()
+	ws, resp, err := d.Dial(c.target.URL, w.header)
+	w.growth.record(i, reqSize, resp)
 	if err != nil {
+		w.stats.error(err, resp)
 		log.Println("fatal error dialing websocket ", i, ":", err)
 		if err == websocket.ErrBadHandshake {
 			log.Printf("%v %v %v\n", resp.StatusCode, resp.Status, resp.Header)
-			io.Copy(os.Stderr, resp.Body)
+			io.Copy(log.Writer(), resp.Body)
 		}
-		return
+		return err
 	}
 	if w.verbose {
 		log.Print("websocket ", i, " connected")
 	}
-	select {
+	w.stats.connected(time.Since(start))
+	rec.HandshakeMS = ms(time.Since(start))
+	defer w.stats.disconnected()
+	w.continuity.record(i, resp.Header)
+	w.mu.Lock()
 	// We could have been stopped already, during ramp up, so check.
-	case <-w.stopCh:
-		return
-	case w.sockets <- ws:
+	if w.stopped() || retired(quit) {
+		w.mu.Unlock()
+		ws.Close()
+		return nil
 	}
-	if w.SendData != "" {
-		ww, err := ws.NextWriter(websocket.BinaryMessage)
-		if err != nil {
+	w.sockets[ws] = quit
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.sockets, ws)
+		w.mu.Unlock()
+	}()
+	if c.profile != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go w.sendLoop(ws, i, c.profile, c, done)
+	} else if w.sendRate > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go w.sendLoop(ws, i, &clientProfile{Rate: w.sendRate}, c, done)
+	} else if len(w.script) > 0 {
+		for k := range w.script {
+			if err := w.send(ws, w.stamp(int64(k), []byte(w.payload(i, int64(k))))); err != nil {
+				log.Print("error writing to websocket: ", err)
+				break
+			}
+		}
+	} else if w.SendData != "" {
+		if err := w.send(ws, w.stamp(0, []byte(w.payload(i, 0)))); err != nil {
 			log.Print("error writing to websocket: ", err)
 		}
-		io.WriteString(ww, w.SendData)
 	}
-	c := &counter{}
-	w.counters <- c
 	for {
+		wait := time.Now()
 		messageType, r, err := ws.NextReader()
 		if err != nil {
+			if !w.stopped() && !retired(quit) {
+				w.stats.error(err, nil)
+			}
 			if w.verbose {
 				log.Print("error reading from websocket ", i, " type ", messageType)
 			}
-			return
+			return err
 		}
 		if messageType == websocket.CloseMessage {
-			return
+			return nil
 		}
+		w.stats.received(time.Since(wait))
+		rec.Received++
+		last := rec.Received == w.messages
 		var out io.Writer = c
 		if w.vv {
 			out = io.MultiWriter(os.Stdout, c)
 		}
-		n, err := io.Copy(out, r)
+		var n int64
+		if w.rtt || w.checking() {
+			var msg []byte
+			msg, err = io.ReadAll(r)
+			out.Write(msg)
+			n = int64(len(msg))
+			if d, ok := roundTrip(msg); ok {
+				rec.rtts.add(d)
+				w.stats.roundTrip(d)
+			}
+			if cerr := w.check(unstamp(msg)); cerr != nil {
+				w.stats.error(cerr, nil)
+				rec.Errors++
+				if w.verbose {
+					log.Print("websocket ", i, " received ", len(msg), " bytes: ", cerr)
+				}
+			}
+		} else {
+			n, err = io.Copy(out, r)
+		}
 		if err != nil {
 			log.Print("error reading from websocket:", err)
-			return
+			return err
 		}
+		c.profile.throttleRead(n)
 		if w.verbose {
 			log.Print("read ", n, " bytes from websocket ", i, " type ", messageType)
 		}
-		select {
-		case <-w.stopCh:
-			return
-		default:
+		if last {
+			ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(w.ct))
+			ws.Close()
+			return nil
+		}
+		if w.stopped() {
+			return nil
 		}
 	}
 }
@@ -326,10 +819,18 @@ func parseInputWithRegexp(input, regx string) ([]string, error) {
 }
 
 type counter struct {
-	N int
+	N       int64 // bytes read, updated atomically
+	sent    int64
+	profile *clientProfile
+	target  *target
 }
 
 func (c *counter) Write(p []byte) (n int, err error) {
-	c.N += len(p)
+	atomic.AddInt64(&c.N, int64(len(p)))
 	return len(p), nil
 }
+
+// read is the number of bytes c has counted so far.
+func (c *counter) read() int {
+	return int(atomic.LoadInt64(&c.N))
+}
@@ -0,0 +1,35 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import "time"
+
+// pacer spaces events evenly at a rate per second, which may be fractional.
+// It is a token bucket holding a single token: an event late because the
+// caller was slow does not let the following ones burst to catch up.
+type pacer struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newPacer(rate float64) *pacer {
+	return &pacer{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait blocks until the next event is due, returning false if stop is closed
+// first. The first event is due immediately.
+func (p *pacer) wait(stop <-chan struct{}) bool {
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	t := time.NewTimer(p.next.Sub(now))
+	defer t.Stop()
+	select {
+	case <-stop:
+		return false
+	case <-t.C:
+	}
+	p.next = p.next.Add(p.interval)
+	return true
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"log"
+	"math/rand"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// payloadData is what -d, -D and script payloads can refer to as templates,
+// e.g. {{.WorkerID}}-{{.Seq}} or {{.RandAlpha 32}}. They are expanded for
+// every message or request.
+type payloadData struct {
+	WorkerID      int
+	Seq           int64 // messages or requests the worker sent before this one
+	TimestampNano int64
+}
+
+const alpha = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// RandAlpha returns n random letters.
+func (payloadData) RandAlpha(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alpha[rand.Intn(len(alpha))]
+	}
+	return string(b)
+}
+
+// randomPayload returns n pseudo-random bytes from seed, letters and digits
+// only if text is set.
+func randomPayload(n int, seed int64, text bool) string {
+	r := rand.New(rand.NewSource(seed))
+	b := make([]byte, n)
+	if !text {
+		r.Read(b)
+		return string(b)
+	}
+	const alnum = alpha + "0123456789"
+	for i := range b {
+		b[i] = alnum[r.Intn(len(alnum))]
+	}
+	return string(b)
+}
+
+// compilePayloads parses SendData and the script as templates. Payloads
+// without "{{" and random ones from -size are sent as they are.
+func (w *Work) compilePayloads() error {
+	parse := func(p string) (*template.Template, error) {
+		if !strings.Contains(p, "{{") {
+			return nil, nil
+		}
+		return template.New("payload").Parse(p)
+	}
+	var err error
+	if !w.random {
+		if w.sendTmpl, err = parse(w.SendData); err != nil {
+			return err
+		}
+	}
+	w.scriptTmpls = make([]*template.Template, len(w.script))
+	for i, p := range w.script {
+		if w.scriptTmpls[i], err = parse(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// payload is the k-th payload worker i sends: from the script in turn if
+// there is one, otherwise SendData, with templates expanded.
+func (w *Work) payload(i int, k int64) string {
+	p, t := w.SendData, w.sendTmpl
+	if len(w.script) > 0 {
+		j := k % int64(len(w.script))
+		p, t = w.script[j], w.scriptTmpls[j]
+	}
+	if t == nil {
+		return p
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, payloadData{WorkerID: i, Seq: k, TimestampNano: time.Now().UnixNano()}); err != nil {
+		log.Print("error expanding payload: ", err)
+		return p
+	}
+	return b.String()
+}
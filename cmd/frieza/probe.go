@@ -0,0 +1,106 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// probe makes a single connection to each target and exchanges a single
+// message, so that an obviously misconfigured target is reported clearly
+// instead of by thousands of failing workers.
+func (w *Work) probe() error {
+	for _, t := range w.targets {
+		err := w.probeURL(t.URL)
+		if err != nil && len(w.targets) > 1 {
+			return fmt.Errorf("%s: %w", t.URL, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Work) probeURL(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", target, err)
+	}
+	if w.mode == "http" {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("unsupported url scheme %q, -mode http uses http:// or https://", u.Scheme)
+		}
+		return w.probeHTTP(target)
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+	case "http", "https":
+		return fmt.Errorf("url scheme is %s, websocket targets use ws:// or wss://, or use -mode http", u.Scheme)
+	default:
+		return fmt.Errorf("unsupported url scheme %q, use ws:// or wss://", u.Scheme)
+	}
+	start := time.Now()
+	ws, resp, err := w.dila.Dial(target, w.header)
+	if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("handshake rejected with %s: %s\n%s", resp.Status,
+			handshakeHint(resp), body)
+	}
+	if err != nil {
+		return fmt.Errorf("could not connect: %w", err)
+	}
+	defer ws.Close()
+	if w.verbose {
+		fmt.Println("probe connected in", time.Since(start))
+		for k, v := range resp.Header {
+			fmt.Println("  ", k+":", v)
+		}
+	}
+	if w.SendData != "" {
+		if err := w.send(ws, []byte(w.payload(0, 0))); err != nil {
+			return fmt.Errorf("could not send probe message: %w", err)
+		}
+	}
+	ws.SetReadDeadline(time.Now().Add(w.ct))
+	_, msg, err := ws.ReadMessage()
+	// Plenty of endpoints are quiet at first or close on purpose, so the
+	// outcome of the read is only informational.
+	switch {
+	case !w.verbose:
+	case err != nil:
+		fmt.Println("probe received no message within", w.ct, ":", err)
+	default:
+		fmt.Println("probe received", len(msg), "bytes")
+	}
+	ws.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	return nil
+}
+
+// handshakeHint suggests what is wrong given a failed handshake response.
+func handshakeHint(resp *http.Response) string {
+	switch c := resp.StatusCode; {
+	case c == http.StatusNotFound:
+		return "the path does not exist on the target"
+	case c == http.StatusUnauthorized, c == http.StatusProxyAuthRequired:
+		return "authentication is required, add credentials with -H"
+	case c == http.StatusForbidden:
+		return "access is forbidden, check credentials and Origin"
+	case c >= 300 && c < 400:
+		return "the target redirects to " + resp.Header.Get("Location") +
+			", websocket clients do not follow redirects"
+	case c >= 200 && c < 300:
+		return "the target answered without upgrading, it is probably not a websocket endpoint"
+	case c >= 500:
+		return "the target is failing"
+	}
+	return "unexpected status"
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// clientProfile describes how a worker behaves once connected, so that a
+// single run can simulate a mix of different clients.
+type clientProfile struct {
+	Name     string
+	Rate     float64       // messages sent per second, 0 sends nothing
+	Size     int           // size of each message sent when -d/-D are not set
+	ReadRate int64         // bytes read per second, 0 is unlimited
+	Ping     time.Duration // interval between pings, 0 sends none
+
+	weight float64
+}
+
+var builtinProfiles = map[string]clientProfile{
+	"mobile":  {Rate: 0.2, Size: 256, ReadRate: 32 << 10, Ping: 30 * time.Second},
+	"desktop": {Rate: 1, Size: 1024},
+	"iot":     {Rate: 0.05, Size: 64, ReadRate: 1 << 10, Ping: time.Minute},
+	"idle":    {},
+}
+
+// parseProfileDef parses a -profile-def value such as
+// "slowphone=rate:0.5,size:100,read:2048,ping:15s".
+func parseProfileDef(def string) (clientProfile, error) {
+	name, settings, ok := strings.Cut(def, "=")
+	if !ok {
+		return clientProfile{}, fmt.Errorf("profile definition %q is not name=settings", def)
+	}
+	p := clientProfile{Name: name}
+	for _, kv := range strings.Split(settings, ",") {
+		k, v, _ := strings.Cut(kv, ":")
+		var err error
+		switch k {
+		case "rate":
+			p.Rate, err = strconv.ParseFloat(v, 64)
+		case "size":
+			p.Size, err = strconv.Atoi(v)
+		case "read":
+			p.ReadRate, err = strconv.ParseInt(v, 10, 64)
+		case "ping":
+			p.Ping, err = time.ParseDuration(v)
+		default:
+			err = fmt.Errorf("unknown setting %q", k)
+		}
+		if err != nil {
+			return p, fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return p, nil
+}
+
+// parseProfiles parses a -profiles value such as "mobile=70,desktop=30" into
+// weighted profiles, looking names up in defs and then builtinProfiles.
+func parseProfiles(spec string, defs []string) ([]*clientProfile, error) {
+	known := make(map[string]clientProfile)
+	for n, p := range builtinProfiles {
+		p.Name = n
+		known[n] = p
+	}
+	for _, d := range defs {
+		p, err := parseProfileDef(d)
+		if err != nil {
+			return nil, err
+		}
+		known[p.Name] = p
+	}
+	var ps []*clientProfile
+	var total float64
+	for _, nw := range strings.Split(spec, ",") {
+		name, weight, _ := strings.Cut(nw, "=")
+		p, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q", name)
+		}
+		p.weight = 1
+		if weight != "" {
+			var err error
+			if p.weight, err = strconv.ParseFloat(weight, 64); err != nil || p.weight <= 0 {
+				return nil, fmt.Errorf("weight of profile %s is not a positive number", name)
+			}
+		}
+		total += p.weight
+		ps = append(ps, &p)
+	}
+	for _, p := range ps {
+		p.weight /= total
+	}
+	return ps, nil
+}
+
+// profileFor deterministically assigns worker i of w.C a profile so that the
+// share of workers per profile matches the weights.
+func (w *Work) profileFor(i int) *clientProfile {
+	if len(w.profiles) == 0 {
+		return nil
+	}
+	weights := make([]float64, len(w.profiles))
+	for j, p := range w.profiles {
+		weights[j] = p.weight
+	}
+	return w.profiles[weighted((float64(i)+0.5)/float64(w.C), weights)]
+}
+
+// sendLoop sends messages and pings on ws for worker i as p describes until
+// done is closed.
+func (w *Work) sendLoop(ws *websocket.Conn, i int, p *clientProfile, c *counter, done <-chan struct{}) {
+	var send, ping <-chan time.Time
+	if p.Rate > 0 {
+		t := time.NewTicker(time.Duration(float64(time.Second) / p.Rate))
+		defer t.Stop()
+		send = t.C
+	}
+	if p.Ping > 0 {
+		t := time.NewTicker(p.Ping)
+		defer t.Stop()
+		ping = t.C
+	}
+	filler := []byte(strings.Repeat("x", p.Size))
+	var k int64
+	for {
+		select {
+		case <-done:
+			return
+		case <-send:
+			payload := []byte(w.payload(i, k))
+			if len(payload) == 0 {
+				payload = filler
+			}
+			if err := w.send(ws, w.stamp(k, payload)); err != nil {
+				return
+			}
+			k++
+			atomic.AddInt64(&c.sent, 1)
+		case <-ping:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(w.ct)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// throttleRead sleeps long enough for n bytes to have been read at p's rate.
+func (p *clientProfile) throttleRead(n int64) {
+	if p != nil && p.ReadRate > 0 {
+		time.Sleep(time.Duration(n * int64(time.Second) / p.ReadRate))
+	}
+}
+
+// printProfileReport prints per profile totals.
+func (w *Work) printProfileReport() {
+	if len(w.profiles) == 0 {
+		return
+	}
+	type totals struct{ workers, read, sent int64 }
+	t := make(map[*clientProfile]*totals)
+	for _, p := range w.profiles {
+		t[p] = &totals{}
+	}
+	w.mu.Lock()
+	for _, c := range w.counters {
+		if pt := t[c.profile]; pt != nil {
+			pt.workers++
+			pt.read += int64(c.read())
+			pt.sent += atomic.LoadInt64(&c.sent)
+		}
+	}
+	w.mu.Unlock()
+	for _, p := range w.profiles {
+		pt := t[p]
+		fmt.Printf("profile %s: %d workers, %d bytes read, %d messages sent\n",
+			p.Name, pt.workers, pt.read, pt.sent)
+	}
+}
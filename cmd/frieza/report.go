@@ -0,0 +1,220 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// connRecord is a row of the -o report: one websocket connection, or in
+// http mode all the requests of one worker.
+type connRecord struct {
+	Worker      int            `json:"worker"`
+	URL         string         `json:"url"`
+	Profile     string         `json:"profile,omitempty"`
+	Start       time.Time      `json:"start"`
+	DurationMS  float64        `json:"duration_ms"`
+	HandshakeMS float64        `json:"handshake_ms,omitempty"`
+	Bytes       int            `json:"bytes"`
+	Received    int            `json:"messages_received"`
+	Sent        int64          `json:"messages_sent"`
+	Requests    int            `json:"requests,omitempty"`
+	Errors      int            `json:"errors,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	RTT         *latencyReport `json:"rtt,omitempty"`
+
+	rtts durations
+}
+
+// newRecord starts a record for worker i using c.
+func (w *Work) newRecord(i int, c *counter) *connRecord {
+	r := &connRecord{Worker: i, URL: c.target.URL, Start: time.Now(), Bytes: c.read(), Sent: atomic.LoadInt64(&c.sent)}
+	if c.profile != nil {
+		r.Profile = c.profile.Name
+	}
+	return r
+}
+
+// finishRecord completes r, started with the same c, and keeps it for the
+// report.
+func (w *Work) finishRecord(r *connRecord, c *counter, err error) {
+	r.DurationMS = ms(time.Since(r.Start))
+	r.Bytes = c.read() - r.Bytes
+	r.Sent = atomic.LoadInt64(&c.sent) - r.Sent
+	r.RTT = newLatencyReport(&r.rtts)
+	if err != nil && !w.stopped() {
+		r.Error = errorCategory(err, nil)
+	}
+	w.mu.Lock()
+	w.records = append(w.records, r)
+	w.mu.Unlock()
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// latencyReport is a latencySummary in milliseconds.
+type latencyReport struct {
+	N      int     `json:"n"`
+	MinMS  float64 `json:"min_ms"`
+	MeanMS float64 `json:"mean_ms"`
+	P50MS  float64 `json:"p50_ms"`
+	P90MS  float64 `json:"p90_ms"`
+	P99MS  float64 `json:"p99_ms"`
+	MaxMS  float64 `json:"max_ms"`
+}
+
+func newLatencyReport(ds *durations) *latencyReport {
+	s := summarize(ds)
+	if s.N == 0 {
+		return nil
+	}
+	return &latencyReport{s.N, ms(s.Min), ms(s.Mean), ms(s.P50), ms(s.P90), ms(s.P99), ms(s.Max)}
+}
+
+// reportSummary is the summary of the -o report.
+type reportSummary struct {
+	Mode        string         `json:"mode"`
+	URLs        []string       `json:"urls"`
+	Workers     int            `json:"workers"`
+	Started     time.Time      `json:"started"`
+	DurationMS  float64        `json:"duration_ms"`
+	Bytes       int            `json:"bytes"`
+	Connects    int            `json:"connects"`
+	Disconnects int            `json:"disconnects"`
+	Requests    int            `json:"requests"`
+	Statuses    map[int]int    `json:"statuses,omitempty"`
+	Errors      map[string]int `json:"errors,omitempty"`
+	Handshake   *latencyReport `json:"handshake,omitempty"`
+	Message     *latencyReport `json:"message,omitempty"`
+	Request     *latencyReport `json:"request,omitempty"`
+	RTT         *latencyReport `json:"rtt,omitempty"`
+}
+
+func (w *Work) summary() reportSummary {
+	handshakes, messages, requests := w.stats.latencies()
+	s := reportSummary{
+		Mode:       w.mode,
+		URLs:       w.urls(),
+		Workers:    w.C,
+		Started:    w.started,
+		DurationMS: ms(w.finished.Sub(w.started)),
+		Requests:   requests.n,
+		Handshake:  newLatencyReport(handshakes),
+		Message:    newLatencyReport(messages),
+		Request:    newLatencyReport(requests),
+		RTT:        newLatencyReport(w.stats.roundTrips()),
+		Statuses:   make(map[int]int),
+		Errors:     make(map[string]int),
+	}
+	w.mu.Lock()
+	for _, c := range w.counters {
+		s.Bytes += c.read()
+	}
+	w.mu.Unlock()
+	st := w.stats
+	st.mu.Lock()
+	s.Connects, s.Disconnects = st.connects, st.disconnects
+	for k, v := range st.statuses {
+		s.Statuses[k] = v
+	}
+	for k, v := range st.errors {
+		s.Errors[k] = v
+	}
+	st.mu.Unlock()
+	return s
+}
+
+// writeReport writes the records and summary to out as format, json or csv.
+func (w *Work) writeReport(out io.Writer, format string) error {
+	w.mu.Lock()
+	records := append([]*connRecord(nil), w.records...)
+	w.mu.Unlock()
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Start.Before(records[j].Start) })
+	s := w.summary()
+	if format == "json" {
+		e := json.NewEncoder(out)
+		e.SetIndent("", "  ")
+		return e.Encode(struct {
+			Summary     reportSummary `json:"summary"`
+			Connections []*connRecord `json:"connections"`
+		}{s, records})
+	}
+
+	// CSV has the connections as a table, then a blank line and the
+	// summary as metric,value rows.
+	cw := csv.NewWriter(out)
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	cw.Write([]string{"worker", "url", "profile", "start", "duration_ms", "handshake_ms", "bytes",
+		"messages_received", "messages_sent", "requests", "errors", "error",
+		"rtt_n", "rtt_p50_ms", "rtt_p90_ms", "rtt_p99_ms", "rtt_max_ms"})
+	for _, r := range records {
+		rtt := []string{"0", "", "", "", ""}
+		if r.RTT != nil {
+			rtt = []string{strconv.Itoa(r.RTT.N), f(r.RTT.P50MS), f(r.RTT.P90MS), f(r.RTT.P99MS), f(r.RTT.MaxMS)}
+		}
+		cw.Write(append([]string{strconv.Itoa(r.Worker), r.URL, r.Profile, r.Start.Format(time.RFC3339Nano),
+			f(r.DurationMS), f(r.HandshakeMS), strconv.Itoa(r.Bytes), strconv.Itoa(r.Received),
+			strconv.FormatInt(r.Sent, 10), strconv.Itoa(r.Requests), strconv.Itoa(r.Errors), r.Error}, rtt...))
+	}
+	cw.Flush()
+	fmt.Fprintln(out)
+	rows := [][]string{
+		{"metric", "value"},
+		{"mode", s.Mode},
+	}
+	for _, u := range s.URLs {
+		rows = append(rows, []string{"url", u})
+	}
+	rows = append(rows, [][]string{
+		{"workers", strconv.Itoa(s.Workers)},
+		{"started", s.Started.Format(time.RFC3339Nano)},
+		{"duration_ms", f(s.DurationMS)},
+		{"bytes", strconv.Itoa(s.Bytes)},
+		{"connects", strconv.Itoa(s.Connects)},
+		{"disconnects", strconv.Itoa(s.Disconnects)},
+		{"requests", strconv.Itoa(s.Requests)},
+	}...)
+	for _, l := range []struct {
+		name string
+		r    *latencyReport
+	}{{"handshake", s.Handshake}, {"message", s.Message}, {"request", s.Request}, {"rtt", s.RTT}} {
+		if l.r == nil {
+			continue
+		}
+		rows = append(rows,
+			[]string{l.name + "_n", strconv.Itoa(l.r.N)},
+			[]string{l.name + "_min_ms", f(l.r.MinMS)},
+			[]string{l.name + "_mean_ms", f(l.r.MeanMS)},
+			[]string{l.name + "_p50_ms", f(l.r.P50MS)},
+			[]string{l.name + "_p90_ms", f(l.r.P90MS)},
+			[]string{l.name + "_p99_ms", f(l.r.P99MS)},
+			[]string{l.name + "_max_ms", f(l.r.MaxMS)})
+	}
+	codes := make([]int, 0, len(s.Statuses))
+	for code := range s.Statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		rows = append(rows, []string{"status_" + strconv.Itoa(code), strconv.Itoa(s.Statuses[code])})
+	}
+	cats := make([]string, 0, len(s.Errors))
+	for c := range s.Errors {
+		cats = append(cats, c)
+	}
+	sort.Strings(cats)
+	for _, c := range cats {
+		rows = append(rows, []string{"error_" + c, strconv.Itoa(s.Errors[c])})
+	}
+	cw.WriteAll(rows)
+	return cw.Error()
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// rttPrefix starts the line -rtt puts in front of every message sent,
+// "frieza-rtt <seq> <unix nanoseconds>\n", so that the round trip can be
+// measured when an echo endpoint sends it back.
+const rttPrefix = "frieza-rtt "
+
+// stamp puts the -rtt header for the seq-th message of a connection in
+// front of payload, if -rtt is set.
+func (w *Work) stamp(seq int64, payload []byte) []byte {
+	if !w.rtt {
+		return payload
+	}
+	return append(fmt.Appendf(nil, "%s%d %d\n", rttPrefix, seq, time.Now().UnixNano()), payload...)
+}
+
+// roundTrip returns the time since msg, an echo, was stamped.
+func roundTrip(msg []byte) (time.Duration, bool) {
+	if !bytes.HasPrefix(msg, []byte(rttPrefix)) {
+		return 0, false
+	}
+	line, _, _ := bytes.Cut(msg[len(rttPrefix):], []byte("\n"))
+	var seq, sent int64
+	if _, err := fmt.Sscanf(string(line), "%d %d", &seq, &sent); err != nil {
+		return 0, false
+	}
+	return time.Since(time.Unix(0, sent)), true
+}
+
+// unstamp returns msg without the -rtt line in front of it, if it has one,
+// so that -expect and -expect-bytes see the payload the echo sent back.
+func unstamp(msg []byte) []byte {
+	if !bytes.HasPrefix(msg, []byte(rttPrefix)) {
+		return msg
+	}
+	if _, payload, ok := bytes.Cut(msg, []byte("\n")); ok {
+		return payload
+	}
+	return msg
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sloExitCode is the exit status of a run that breached -max-error-rate or
+// -max-p99.
+const sloExitCode = 2
+
+// slo are the limits a run must stay within to succeed. Zero is no limit.
+type slo struct {
+	maxErrorRate float64
+	maxP99       time.Duration
+}
+
+// parseRate parses a rate such as "1%" or "0.01".
+func parseRate(s string) (float64, error) {
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		f, err := strconv.ParseFloat(p, 64)
+		return f / 100, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// errorRate is the share of errors among connections, messages received and
+// requests, errors included. Responses with a 4xx or 5xx status are errors.
+func (s *stats) errorRate() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failed := 0
+	for _, n := range s.errors {
+		failed += n
+	}
+	ops := failed + s.connects + s.messages.n + s.requests.n
+	for code, n := range s.statuses {
+		if code >= 400 {
+			failed += n
+		}
+	}
+	if ops == 0 {
+		return 0
+	}
+	return float64(failed) / float64(ops)
+}
+
+// sloLatencies are the latencies -max-p99 applies to: requests in http mode,
+// otherwise round trips with -rtt and handshakes without.
+func (w *Work) sloLatencies() (string, *durations) {
+	handshakes, _, requests := w.stats.latencies()
+	switch {
+	case w.mode == "http":
+		return "request", requests
+	case w.rtt:
+		return "round trip", w.stats.roundTrips()
+	}
+	return "handshake", handshakes
+}
+
+// breached describes how the run so far breaches w.slo, or is empty.
+func (w *Work) breached() string {
+	var bs []string
+	if max := w.slo.maxErrorRate; max > 0 {
+		if r := w.stats.errorRate(); r > max {
+			bs = append(bs, fmt.Sprintf("error rate %.2f%% is over %.2f%%", 100*r, 100*max))
+		}
+	}
+	if max := w.slo.maxP99; max > 0 {
+		name, ds := w.sloLatencies()
+		if s := summarize(ds); s.N > 0 && s.P99 > max {
+			bs = append(bs, fmt.Sprintf("%s p99 %s is over %s", name, s.P99.Round(time.Microsecond), max))
+		}
+	}
+	return strings.Join(bs, ", ")
+}
+
+// failFast stops the work as soon as it breaches w.slo, checking every
+// second.
+func (w *Work) failFast() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-t.C:
+		}
+		if b := w.breached(); b != "" {
+			fmt.Println("stopping early:", b)
+			w.Stop()
+			return
+		}
+	}
+}
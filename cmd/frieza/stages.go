@@ -0,0 +1,138 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stage changes the number of workers linearly from from to to over d.
+type stage struct {
+	from, to int
+	d        time.Duration
+}
+
+// parseStages parses a -stages value such as
+// "ramp:0-500c/2m,hold:5m,ramp:500-0c/1m". A ramp may leave out where it
+// starts, "ramp:100c/30s", to start from where the previous stage ended.
+func parseStages(spec string) ([]stage, error) {
+	var ss []stage
+	last := 0
+	for _, s := range strings.Split(spec, ",") {
+		kind, v, _ := strings.Cut(s, ":")
+		var st stage
+		var err error
+		switch kind {
+		case "hold":
+			st = stage{from: last, to: last}
+			st.d, err = time.ParseDuration(v)
+		case "ramp":
+			counts, d, ok := strings.Cut(v, "/")
+			counts, ok2 := strings.CutSuffix(counts, "c")
+			if !ok || !ok2 {
+				return nil, fmt.Errorf("stage %q is not ramp:from-toc/duration", s)
+			}
+			from, to, ranged := strings.Cut(counts, "-")
+			st.from = last
+			if ranged {
+				if st.from, err = strconv.Atoi(from); err != nil {
+					return nil, fmt.Errorf("stage %q: %w", s, err)
+				}
+			} else {
+				to = from
+			}
+			if st.to, err = strconv.Atoi(to); err != nil {
+				return nil, fmt.Errorf("stage %q: %w", s, err)
+			}
+			st.d, err = time.ParseDuration(d)
+		default:
+			return nil, fmt.Errorf("unknown stage %q, want ramp or hold", kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("stage %q: %w", s, err)
+		}
+		if st.from < 0 || st.to < 0 || st.d <= 0 {
+			return nil, fmt.Errorf("stage %q: counts must not be negative and durations must be positive", s)
+		}
+		ss = append(ss, st)
+		last = st.to
+	}
+	return ss, nil
+}
+
+// peakWorkers is the most workers any of ss runs.
+func peakWorkers(ss []stage) int {
+	n := 0
+	for _, s := range ss {
+		n = max(n, s.from, s.to)
+	}
+	return n
+}
+
+// runStages starts and retires workers to follow w.stages, then stops the
+// work. The workers most recently started are retired first.
+func (w *Work) runStages() {
+	var wg sync.WaitGroup
+	var active []chan struct{} // quit channel of each running worker, by index
+	scale := func(n int) {
+		for len(active) < n {
+			i, quit := len(active), make(chan struct{})
+			active = append(active, quit)
+			wg.Add(1)
+			go func() {
+				w.run(i, quit)
+				wg.Done()
+			}()
+		}
+		for len(active) > n {
+			quit := active[len(active)-1]
+			active = active[:len(active)-1]
+			w.retire(quit)
+		}
+	}
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+stages:
+	for i, s := range w.stages {
+		if w.verbose {
+			fmt.Printf("stage %d: %d to %d workers over %s\n", i, s.from, s.to, s.d)
+		}
+		start := time.Now()
+		for {
+			elapsed := time.Since(start)
+			if elapsed >= s.d {
+				scale(s.to)
+				break
+			}
+			scale(s.from + int(float64(s.to-s.from)*float64(elapsed)/float64(s.d)))
+			select {
+			case <-w.stopCh:
+				break stages
+			case <-t.C:
+			}
+		}
+	}
+	w.Stop()
+	wg.Wait()
+	w.finished = time.Now()
+}
+
+// retire closes quit, making its worker finish, and closes the websocket of
+// that worker if it has one.
+func (w *Work) retire(quit chan struct{}) {
+	close(quit)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for s, q := range w.sockets {
+		if q == quit {
+			s.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(w.ct))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stats collects connection level measurements across all workers.
+type stats struct {
+	mu          sync.Mutex
+	connects    int
+	disconnects int
+	handshakes  durations
+	messages    durations // waits for each websocket message
+	rtts        durations // round trips of -rtt echoes
+	errors      map[string]int
+
+	// http mode
+	requests durations
+	statuses map[int]int
+}
+
+func newStats() *stats {
+	return &stats{errors: make(map[string]int), statuses: make(map[int]int)}
+}
+
+func (s *stats) connected(handshake time.Duration) {
+	s.mu.Lock()
+	s.connects++
+	s.handshakes.add(handshake)
+	s.mu.Unlock()
+}
+
+// received records waiting d for a websocket message.
+func (s *stats) received(d time.Duration) {
+	s.mu.Lock()
+	s.messages.add(d)
+	s.mu.Unlock()
+}
+
+// roundTrip records the round trip d of an echoed message.
+func (s *stats) roundTrip(d time.Duration) {
+	s.mu.Lock()
+	s.rtts.add(d)
+	s.mu.Unlock()
+}
+
+// roundTrips returns a copy of the round trips recorded.
+func (s *stats) roundTrips() *durations {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rtts.clone()
+}
+
+// responded records a completed http request.
+func (s *stats) responded(status int, d time.Duration) {
+	s.mu.Lock()
+	s.requests.add(d)
+	s.statuses[status]++
+	s.mu.Unlock()
+}
+
+func (s *stats) disconnected() {
+	s.mu.Lock()
+	s.disconnects++
+	s.mu.Unlock()
+}
+
+// error counts err under a coarse category. resp may be nil.
+func (s *stats) error(err error, resp *http.Response) {
+	s.mu.Lock()
+	s.errors[errorCategory(err, resp)]++
+	s.mu.Unlock()
+}
+
+// latencies returns copies of the handshake, message and request latencies.
+func (s *stats) latencies() (handshakes, messages, requests *durations) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handshakes.clone(), s.messages.clone(), s.requests.clone()
+}
+
+type errorCount struct {
+	category string
+	n        int
+}
+
+// topErrors returns the n most frequent error categories.
+func (s *stats) topErrors(n int) []errorCount {
+	s.mu.Lock()
+	ec := make([]errorCount, 0, len(s.errors))
+	for c, v := range s.errors {
+		ec = append(ec, errorCount{c, v})
+	}
+	s.mu.Unlock()
+	sort.Slice(ec, func(i, j int) bool {
+		if ec[i].n == ec[j].n {
+			return ec[i].category < ec[j].category
+		}
+		return ec[i].n > ec[j].n
+	})
+	return ec[:min(n, len(ec))]
+}
+
+func errorCategory(err error, resp *http.Response) string {
+	var ce *websocket.CloseError
+	var ne net.Error
+	var oe *net.OpError
+	switch {
+	case errors.Is(err, websocket.ErrBadHandshake) && resp != nil:
+		return "handshake " + strconv.Itoa(resp.StatusCode)
+	case errors.As(err, &ce):
+		return "close " + strconv.Itoa(ce.Code)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection reset"
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return "timeout"
+	case errors.As(err, &oe):
+		return oe.Op + " error"
+	}
+	return err.Error()
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// target is one of the URLs workers are spread across.
+type target struct {
+	URL    string
+	weight float64
+}
+
+// parseTargets parses url arguments, each optionally weighted with a prefix
+// such as "80:ws://host/ws-echo". Targets without a weight weigh 1.
+func parseTargets(args []string) ([]*target, error) {
+	var ts []*target
+	var total float64
+	for _, a := range args {
+		t := &target{URL: a, weight: 1}
+		if weight, u, ok := strings.Cut(a, ":"); ok && strings.Contains(u, "://") {
+			var err error
+			if t.weight, err = strconv.ParseFloat(weight, 64); err != nil || t.weight <= 0 {
+				return nil, fmt.Errorf("weight of %s is not a positive number", u)
+			}
+			t.URL = u
+		}
+		total += t.weight
+		ts = append(ts, t)
+	}
+	for _, t := range ts {
+		t.weight /= total
+	}
+	return ts, nil
+}
+
+// weighted picks one of weights, which add up to 1, by where f in [0, 1)
+// falls among them.
+func weighted(f float64, weights []float64) int {
+	for j, wt := range weights {
+		if f < wt {
+			return j
+		}
+		f -= wt
+	}
+	return len(weights) - 1
+}
+
+// targetFor deterministically assigns worker i a target. Workers are spread
+// by the golden ratio rather than in order, so that targets do not line up
+// with profiles and each target gets its share early in a ramp.
+func (w *Work) targetFor(i int) *target {
+	weights := make([]float64, len(w.targets))
+	for j, t := range w.targets {
+		weights[j] = t.weight
+	}
+	_, f := math.Modf((float64(i) + 0.5) * math.Phi)
+	return w.targets[weighted(f, weights)]
+}
+
+// urls returns the URLs of all targets.
+func (w *Work) urls() []string {
+	us := make([]string, len(w.targets))
+	for i, t := range w.targets {
+		us[i] = t.URL
+	}
+	return us
+}
+
+// printTargetReport prints per target totals when there are several.
+func (w *Work) printTargetReport() {
+	if len(w.targets) < 2 {
+		return
+	}
+	type totals struct{ workers, read int }
+	t := make(map[*target]*totals)
+	for _, tg := range w.targets {
+		t[tg] = &totals{}
+	}
+	w.mu.Lock()
+	for _, c := range w.counters {
+		if tt := t[c.target]; tt != nil {
+			tt.workers++
+			tt.read += c.read()
+		}
+	}
+	w.mu.Unlock()
+	for _, tg := range w.targets {
+		fmt.Printf("target %s: %d workers, %d bytes read\n", tg.URL, t[tg].workers, t[tg].read)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const sparkWidth = 60
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders vs scaled to their maximum.
+func sparkline(vs []float64) string {
+	var hi float64
+	for _, v := range vs {
+		hi = max(hi, v)
+	}
+	var b strings.Builder
+	for _, v := range vs {
+		i := 0
+		if hi > 0 {
+			i = int(v / hi * float64(len(sparkTicks)-1))
+		}
+		b.WriteRune(sparkTicks[i])
+	}
+	return b.String()
+}
+
+// appendSample appends v to vs keeping at most sparkWidth values.
+func appendSample(vs []float64, v float64) []float64 {
+	vs = append(vs, v)
+	if len(vs) > sparkWidth {
+		vs = vs[len(vs)-sparkWidth:]
+	}
+	return vs
+}
+
+// runTUI redraws a live dashboard in place every second until the work is
+// stopped.
+func (w *Work) runTUI() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	var connRates, byteRates, latencies []float64
+	var lastConnects, lastBytes, lastHandshakes int
+	var lastHandshakeSum time.Duration
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-t.C:
+		}
+		w.mu.Lock()
+		bytes := 0
+		for _, c := range w.counters {
+			bytes += c.read()
+		}
+		w.mu.Unlock()
+		s := w.stats
+		s.mu.Lock()
+		connects, disconnects := s.connects, s.disconnects
+		var avg time.Duration
+		if n := s.handshakes.n - lastHandshakes; n > 0 {
+			avg = (s.handshakes.sum - lastHandshakeSum) / time.Duration(n)
+		}
+		lastHandshakes, lastHandshakeSum = s.handshakes.n, s.handshakes.sum
+		s.mu.Unlock()
+
+		connRates = appendSample(connRates, float64(connects-lastConnects))
+		byteRates = appendSample(byteRates, float64(bytes-lastBytes))
+		latencies = appendSample(latencies, float64(avg))
+		lastConnects, lastBytes = connects, bytes
+
+		var b strings.Builder
+		b.WriteString("\033[H\033[2J")
+		fmt.Fprintf(&b, "frieza %s  elapsed %s\n\n", strings.Join(w.urls(), " "), time.Since(w.started).Round(time.Second))
+		fmt.Fprintf(&b, "active %d/%d  connects %d  disconnects %d  bytes %d\n\n",
+			atomic.LoadInt64(&w.running), w.C, connects, disconnects, bytes)
+		fmt.Fprintf(&b, "connects/s  %-8.0f %s\n", connRates[len(connRates)-1], sparkline(connRates))
+		fmt.Fprintf(&b, "bytes/s     %-8.0f %s\n", byteRates[len(byteRates)-1], sparkline(byteRates))
+		fmt.Fprintf(&b, "handshake   %-8s %s\n\n", avg.Round(time.Millisecond), sparkline(latencies))
+		b.WriteString("top errors:\n")
+		for _, e := range w.stats.topErrors(5) {
+			fmt.Fprintf(&b, "  %6d  %s\n", e.n, e.category)
+		}
+		fmt.Print(b.String())
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// connInfo is kept in the context of every http connection.
+type connInfo struct {
+	accepted time.Time
+	local    string
+	requests atomic.Int64
+}
+
+type connInfoKey struct{}
+
+// trackConn is the http.Server ConnContext which attaches a connInfo.
+func trackConn(ctx context.Context, c net.Conn) context.Context {
+	ctx = limitConnContext(ctx, c)
+	return context.WithValue(ctx, connInfoKey{}, &connInfo{accepted: time.Now(), local: c.LocalAddr().String()})
+}
+
+// countRequests wraps h to count the requests made on each connection.
+func countRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ci, ok := r.Context().Value(connInfoKey{}).(*connInfo); ok {
+			ci.requests.Add(1)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+type connInfoReply struct {
+	RemoteAddr string   `json:"remoteAddr"`
+	LocalAddr  string   `json:"localAddr,omitempty"`
+	Proto      string   `json:"proto"`
+	TLS        *echoTLS `json:"tls,omitempty"`
+	Reused     bool     `json:"reused"`
+	Requests   int64    `json:"requests"`
+	ConnAge    string   `json:"connAge,omitempty"`
+}
+
+// conninfo describes the connection the request arrived on, including
+// whether the client reused it for more than one request.
+func conninfo(w http.ResponseWriter, r *http.Request) {
+	ci := connInfoReply{RemoteAddr: r.RemoteAddr, Proto: r.Proto}
+	if c, ok := r.Context().Value(connInfoKey{}).(*connInfo); ok {
+		ci.LocalAddr = c.local
+		ci.Requests = c.requests.Load()
+		ci.Reused = ci.Requests > 1
+		ci.ConnAge = time.Since(c.accepted).String()
+	}
+	if cs := r.TLS; cs != nil {
+		ci.TLS = newEchoTLS(cs)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(ci)
+}
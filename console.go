@@ -0,0 +1,218 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// events fans log output out to console sessions which are tailing it.
+var events = &eventTail{subs: make(map[chan string]struct{})}
+
+type eventTail struct {
+	mu   sync.Mutex
+	subs map[chan string]struct{}
+}
+
+// Write implements io.Writer so that eventTail can be added to the log output.
+// Slow subscribers miss events rather than blocking logging.
+func (e *eventTail) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs {
+		select {
+		case ch <- string(p):
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+func (e *eventTail) subscribe() chan string {
+	ch := make(chan string, 100)
+	e.mu.Lock()
+	e.subs[ch] = struct{}{}
+	e.mu.Unlock()
+	return ch
+}
+
+func (e *eventTail) unsubscribe(ch chan string) {
+	e.mu.Lock()
+	delete(e.subs, ch)
+	e.mu.Unlock()
+}
+
+// serveConsole listens on addr for telnet style operator sessions. If token is
+// set, sessions must give it before any command is run.
+func serveConsole(addr, token string) {
+	l, err := listen("console", addr)
+	if err != nil {
+		fatal("console listen", "err", err)
+	}
+	slog.Info("console listening", "addr", l.Addr())
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			slog.Warn("console accept", "err", err)
+			continue
+		}
+		go consoleSession(c, token)
+	}
+}
+
+const consoleHelp = `commands:
+	help - this text
+	conns - list remote TCP connections
+	addconn <host:port_delay_payload> - create a remote TCP connection
+	rmconn <n> - remove remote TCP connection n
+	vb - list virtual backends
+	restart <n> [down] - restart virtual backend n, unavailable for down (default 10s)
+	faults - show the runtime faults
+	wan [profile] - set the wan profile of requests which pick none, none without a profile
+	pause <duration> - stop writes on every pausable connection for duration
+	tail - show a live tail of events until enter is pressed
+	quit - end the session
+`
+
+func consoleSession(c net.Conn, token string) {
+	defer c.Close()
+	slog.Info("console session", "remote", c.RemoteAddr())
+	s := bufio.NewScanner(c)
+	if token != "" {
+		fmt.Fprint(c, "token: ")
+		if !s.Scan() || !authEqual(strings.TrimSpace(s.Text()), token) {
+			slog.Warn("console session unauthorized", "remote", c.RemoteAddr())
+			fmt.Fprintln(c, "unauthorized")
+			return
+		}
+	}
+	fmt.Fprint(c, "slowserver console, type help for commands\n> ")
+	for s.Scan() {
+		args := strings.Fields(s.Text())
+		if len(args) == 0 {
+			fmt.Fprint(c, "> ")
+			continue
+		}
+		switch args[0] {
+		case "help":
+			fmt.Fprint(c, consoleHelp)
+		case "conns":
+			for i, cn := range conns {
+				fmt.Fprintf(c, "%d %s reconnects:%d totalRR:%d err:%v\n", i,
+					cn.addr, cn.reconnects, cn.totalRR, cn.err)
+			}
+		case "addconn":
+			if len(args) < 2 {
+				fmt.Fprintln(c, "usage: addconn <host:port_delay_payload>")
+				break
+			}
+			if err := addConnection(args[1]); err != nil {
+				fmt.Fprintln(c, "error:", err)
+			}
+		case "rmconn":
+			i, err := consoleIndex(args, len(conns))
+			if err != nil {
+				fmt.Fprintln(c, "error:", err)
+				break
+			}
+			rmConnection(i)
+		case "vb":
+			for _, vb := range vbackends {
+				vb.mu.Lock()
+				fmt.Fprintf(c, "%d gen:%d down:%t delay:%s conns:%d\n", vb.id,
+					vb.gen, vb.down, vb.delay, len(vb.conns))
+				vb.mu.Unlock()
+			}
+		case "restart":
+			i, err := consoleIndex(args, len(vbackends))
+			if err != nil {
+				fmt.Fprintln(c, "error:", err)
+				break
+			}
+			down := 10 * time.Second
+			if len(args) > 2 {
+				if down, err = time.ParseDuration(args[2]); err != nil {
+					fmt.Fprintln(c, "error:", err)
+					break
+				}
+			}
+			go vbackends[i].restart(down)
+		case "faults":
+			fmt.Fprintf(c, "wan:%q paused:%t\n", *globalWan.Load(), pausedUntil.Load() != nil)
+		case "wan":
+			name := ""
+			if len(args) > 1 {
+				name = args[1]
+			}
+			if err := setGlobalWan(name); err != nil {
+				fmt.Fprintln(c, "error:", err)
+			}
+		case "pause":
+			if len(args) < 2 {
+				fmt.Fprintln(c, "usage: pause <duration>")
+				break
+			}
+			d, err := time.ParseDuration(args[1])
+			if err != nil {
+				fmt.Fprintln(c, "error:", err)
+				break
+			}
+			go pauseWorld(d)
+		case "tail":
+			consoleTail(c, s)
+		case "quit", "exit":
+			return
+		default:
+			fmt.Fprintf(c, "unknown command %q, type help for commands\n", args[0])
+		}
+		fmt.Fprint(c, "> ")
+	}
+}
+
+// consoleIndex parses args[1] as an index less than n.
+func consoleIndex(args []string, n int) (int, error) {
+	if len(args) < 2 {
+		return 0, fmt.Errorf("%s requires an index", args[0])
+	}
+	i, err := strconv.Atoi(args[1])
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || i >= n {
+		return 0, fmt.Errorf("index %d out of range", i)
+	}
+	return i, nil
+}
+
+// consoleTail copies events to c until a line is read from s. It only
+// returns once it is done with s, so that the session can scan it again.
+func consoleTail(c net.Conn, s *bufio.Scanner) {
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+	fmt.Fprintln(c, "tailing events, press enter to stop")
+	done := make(chan struct{})
+	go func() {
+		s.Scan()
+		close(done)
+	}()
+	for {
+		select {
+		case e := <-ch:
+			if _, err := io.WriteString(c, e); err != nil {
+				c.Close() // ends the scan below
+				<-done
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cookieSeq makes storm cookie names unique so client cookie jars keep
+// growing over a long session.
+var cookieSeq atomic.Int64
+
+// locales are rotated through by cookieStorm for localized headers.
+var locales = []struct{ lang, greeting string }{
+	{"en-US", "Hello"},
+	{"de-DE", "Grüß Gott"},
+	{"ja-JP", "こんにちは"},
+	{"ru-RU", "Здравствуйте"},
+	{"ar-EG", "مرحبا"},
+	{"zh-CN", "你好"},
+}
+
+// maxCookieStorm caps the cookie bytes the cookieStorm and cookieSize query
+// params may ask for on one response.
+var maxCookieStorm int64 = 1 << 20
+
+// stormCookieOverhead is about what each storm cookie adds to the response
+// besides its value, so that many empty cookies count too.
+const stormCookieOverhead = 32
+
+// stormTooBig reports whether n cookies of sz bytes are over maxCookieStorm.
+func stormTooBig(n, sz int) bool {
+	each := int64(sz) + stormCookieOverhead
+	return each > maxCookieStorm || int64(n) > maxCookieStorm/each
+}
+
+// cookieStorm wraps h so that responses carry count large cookies of size
+// bytes each along with localized headers. The cookieStorm and cookieSize
+// query params override the defaults for a single request, up to
+// -maxCookieStorm.
+func cookieStorm(h http.Handler, count, size int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		n := intQueryParam(q, "cookieStorm", count)
+		sz := max(intQueryParam(q, "cookieSize", size), 0)
+		if (q.Has("cookieStorm") || q.Has("cookieSize")) && n > 0 && stormTooBig(n, sz) {
+			http.Error(w, fmt.Sprintf("refusing a cookie storm of %d cookies of %d bytes, over -maxCookieStorm %d",
+				n, sz, maxCookieStorm), http.StatusBadRequest)
+			return
+		}
+		if n > 0 {
+			noteFault(r, "cookieStorm")
+			value := strings.Repeat("c", sz)
+			for i := 0; i < n; i++ {
+				http.SetCookie(w, &http.Cookie{
+					Name:  "storm" + strconv.FormatInt(cookieSeq.Add(1), 10),
+					Value: value,
+					Path:  "/",
+				})
+			}
+			l := locales[cookieSeq.Load()%int64(len(locales))]
+			w.Header().Set("Content-Language", l.lang)
+			w.Header().Set("X-Greeting", l.greeting)
+			for _, l := range locales {
+				w.Header().Add("X-Localized-"+l.lang, strings.Repeat(l.greeting+" ", max(sz/len(l.greeting), 1)))
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// cookieAttrs are the query params of /cookies/set and /session/login which
+// set cookie attributes rather than naming cookies.
+var cookieAttrs = map[string]bool{
+	"delay": true, "path": true, "domain": true, "secure": true, "httpOnly": true,
+	"sameSite": true, "maxAge": true, "ttl": true, "skew": true,
+}
+
+// cookieFromQuery makes a cookie with the attributes in q. An Expires
+// attribute is set ttl from now, shifted by skew to mimic a server whose
+// clock disagrees with the client's.
+func cookieFromQuery(q url.Values, name, value string) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     q.Get("path"),
+		Domain:   q.Get("domain"),
+		Secure:   q.Get("secure") == "true",
+		HttpOnly: q.Get("httpOnly") == "true",
+		MaxAge:   intQueryParam(q, "maxAge", 0),
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	switch strings.ToLower(q.Get("sameSite")) {
+	case "lax":
+		c.SameSite = http.SameSiteLaxMode
+	case "strict":
+		c.SameSite = http.SameSiteStrictMode
+	case "none":
+		c.SameSite = http.SameSiteNoneMode
+	}
+	if ttl := timeQueryParam(q, "ttl", 0); ttl > 0 {
+		c.Expires = time.Now().Add(ttl + timeQueryParam(q, "skew", 0))
+	}
+	return c
+}
+
+// cookiesSet sets a cookie for every query param not in cookieAttrs, after
+// delay.
+func cookiesSet(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	time.Sleep(timeQueryParam(q, "delay", 0))
+	for name, values := range q {
+		if !cookieAttrs[name] {
+			http.SetCookie(w, cookieFromQuery(q, name, values[0]))
+		}
+	}
+	cookiesList(w, r)
+}
+
+// cookiesDelete expires the cookies named by the query params.
+func cookiesDelete(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	time.Sleep(timeQueryParam(q, "delay", 0))
+	for name := range q {
+		if !cookieAttrs[name] {
+			http.SetCookie(w, &http.Cookie{Name: name, Path: "/", MaxAge: -1})
+		}
+	}
+	cookiesList(w, r)
+}
+
+// cookiesList responds with the cookies sent as JSON.
+func cookiesList(w http.ResponseWriter, r *http.Request) {
+	cookies := make(map[string]string)
+	for _, c := range r.Cookies() {
+		cookies[c.Name] = c.Value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cookies)
+}
+
+// sessions maps session cookie values to when the server expires them.
+var sessions = struct {
+	sync.Mutex
+	m map[string]time.Time
+}{m: make(map[string]time.Time)}
+
+// sessionLogin slowly issues a session cookie valid for ttl on the server.
+// The cookie's own expiry is ttl shifted by skew.
+func sessionLogin(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	time.Sleep(timeQueryParam(q, "delay", 2*time.Second))
+	ttl := timeQueryParam(q, "ttl", 5*time.Minute)
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	sessions.Lock()
+	now := time.Now()
+	for k, exp := range sessions.m {
+		if now.After(exp) {
+			delete(sessions.m, k)
+		}
+	}
+	sessions.m[id] = now.Add(ttl)
+	sessions.Unlock()
+	if !q.Has("ttl") {
+		q.Set("ttl", ttl.String())
+	}
+	http.SetCookie(w, cookieFromQuery(q, "session", id))
+	fmt.Fprintf(w, "session %s valid for %s\n", id, ttl)
+}
+
+// session requires the cookie from sessionLogin, answering 401 without a
+// session the server considers valid.
+func session(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(timeQueryParam(r.URL.Query(), "delay", 0))
+	c, err := r.Cookie("session")
+	if err != nil {
+		http.Error(w, "no session cookie, get one from /session/login", http.StatusUnauthorized)
+		return
+	}
+	sessions.Lock()
+	exp, ok := sessions.m[c.Value]
+	sessions.Unlock()
+	if !ok || time.Now().After(exp) {
+		http.Error(w, "session unknown or expired", http.StatusUnauthorized)
+		return
+	}
+	fmt.Fprintf(w, "session %s valid until %s\n", c.Value, exp.UTC().Format(time.RFC3339))
+}
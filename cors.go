@@ -0,0 +1,65 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// cors answers CORS preflights and actual requests, broken according to the
+// mode query param:
+//
+//	correct - allow the request's Origin
+//	slow    - delay preflights by delay (default 2s)
+//	wrong   - allow a different origin than the request's
+//	missing - answer preflights correctly but leave the CORS headers off the
+//	          actual response
+//	error   - answer preflights with a 500
+//
+// The maxAge query param sets Access-Control-Max-Age, 0 by default so that
+// every request is preflighted.
+func cors(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	mode := q.Get("mode")
+	origin := r.Header.Get("Origin")
+	if mode == "wrong" {
+		origin = "https://wrong.example"
+	}
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	switch mode {
+	case "", "correct", "wrong", "missing":
+	case "slow":
+		if preflight {
+			time.Sleep(timeQueryParam(q, "delay", 2*time.Second))
+		}
+	case "error":
+		if preflight {
+			noteFault(r, "cors")
+			http.Error(w, "preflight failed", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "unknown mode "+mode, http.StatusBadRequest)
+		return
+	}
+	if mode == "wrong" || mode == "missing" && !preflight {
+		noteFault(r, "cors")
+	}
+	if preflight || mode != "missing" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Add("Vary", "Origin")
+	}
+	if preflight {
+		w.Header().Set("Access-Control-Allow-Methods", r.Header.Get("Access-Control-Request-Method"))
+		if h := r.Header.Get("Access-Control-Request-Headers"); h != "" {
+			w.Header().Set("Access-Control-Allow-Headers", h)
+		}
+		w.Header().Set("Access-Control-Max-Age", fmt.Sprint(intQueryParam(q, "maxAge", 0)))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	fmt.Fprintf(w, "%s %s from origin %q\n", r.Method, r.URL.Path, r.Header.Get("Origin"))
+}
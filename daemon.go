@@ -0,0 +1,38 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"log/slog"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// dropPrivileges switches the process to the user called name and its
+// primary group, giving up supplementary groups.
+func dropPrivileges(name string) error {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Setgroups(nil); err != nil {
+		return err
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return err
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return err
+	}
+	slog.Info("dropped privileges", "user", name, "uid", uid, "gid", gid)
+	return nil
+}
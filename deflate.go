@@ -0,0 +1,105 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// deflate plays permessage-deflate games. mode=bomb sends count messages of
+// size zero bytes at the best compression, which are tiny on the wire and huge
+// once inflated. mode=takeover negotiates permessage-deflate without
+// server_no_context_takeover and then really does reuse the compression
+// context across count messages, which clients that always reset their
+// context cannot inflate.
+func deflate(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	mode := r.Form.Get("mode")
+	size := sizeQueryParam(r.Form, "size", 16<<20)
+	count := intQueryParam(r.Form, "count", 10)
+	delay := timeQueryParam(r.Form, "delay", 100*time.Millisecond)
+	switch mode {
+	case "bomb":
+		deflateBomb(w, r, size, count, delay)
+	case "takeover":
+		deflateTakeover(w, r, count, delay)
+	default:
+		http.Error(w, "mode must be one of: bomb, takeover", http.StatusBadRequest)
+	}
+}
+
+func deflateBomb(w http.ResponseWriter, r *http.Request, size int64, count int, delay time.Duration) {
+	c, err := compressUpgrader.Upgrade(w, r, w.Header())
+	if err != nil {
+		slog.Warn("deflate upgrade", "err", err)
+		return
+	}
+	defer c.Close()
+	c.SetCompressionLevel(flate.BestCompression)
+	done := discardReads(c)
+	for i := 0; i < count; i++ {
+		mw, err := c.NextWriter(websocket.BinaryMessage)
+		if err != nil {
+			slog.Debug("deflate write", "err", err)
+			return
+		}
+		_, err = io.CopyN(mw, repeatReader(0), size)
+		if err == nil {
+			err = mw.Close()
+		}
+		if err != nil {
+			slog.Debug("deflate write", "err", err)
+			return
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(delay):
+		}
+	}
+	<-done
+}
+
+func deflateTakeover(w http.ResponseWriter, r *http.Request, count int, delay time.Duration) {
+	key := r.Header.Get("Sec-Websocket-Key")
+	if !websocket.IsWebSocketUpgrade(r) || key == "" {
+		http.Error(w, "not a websocket handshake", http.StatusBadRequest)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate") {
+		slog.Info("/ws-deflate client did not offer permessage-deflate, sending it anyway")
+	}
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		slog.Warn("deflate hijack", "err", err)
+		return
+	}
+	defer conn.Close()
+	io.WriteString(conn, switchingProtocols(key, "Sec-WebSocket-Extensions: permessage-deflate\r\n"))
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestSpeed)
+	for i := 0; i < count; i++ {
+		// Repeating the same text makes later messages mostly back
+		// references into earlier ones.
+		fw.Write([]byte("context takeover makes this message refer to the last one\n"))
+		fw.Flush()
+		// Strip the 0x00 0x00 0xff 0xff sync flush tail as RFC 7692 says.
+		payload := bytes.TrimSuffix(buf.Bytes(), []byte{0, 0, 0xff, 0xff})
+		if err := writeRawFrame(conn, 0x80|0x40|opText, nil, payload); err != nil {
+			slog.Debug("deflate write", "err", err)
+			return
+		}
+		buf.Reset()
+		time.Sleep(delay)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Minute))
+	io.Copy(io.Discard, brw)
+}
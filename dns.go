@@ -0,0 +1,135 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"log/slog"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsBehavior configures the misbehaving DNS server. The first label of a
+// queried name may override mode (e.g. servfail.example.com) or delay (e.g.
+// delay-2s.example.com).
+type dnsBehavior struct {
+	mode  string // answer, rotate, servfail, nxdomain, truncate or drop
+	delay time.Duration
+	addrs []netip.Addr
+}
+
+var dnsModes = []string{"answer", "rotate", "servfail", "nxdomain", "truncate", "drop"}
+
+// dnsRotation counts queries so rotate mode can cycle answers.
+var dnsRotation atomic.Int64
+
+// parseDNSAddrs parses a comma separated list of IPv4 and IPv6 addresses.
+func parseDNSAddrs(s string) []netip.Addr {
+	var addrs []netip.Addr
+	for _, a := range strings.Split(s, ",") {
+		ip, err := netip.ParseAddr(strings.TrimSpace(a))
+		if err != nil {
+			slog.Warn("could not parse dns address", "addr", a, "err", err)
+			continue
+		}
+		addrs = append(addrs, ip)
+	}
+	return addrs
+}
+
+// serveDNS answers DNS queries over UDP on addr as b says.
+func serveDNS(addr string, b dnsBehavior) {
+	c, err := listenPacket(addr)
+	if err != nil {
+		fatal("dns listen", "err", err)
+	}
+	slog.Info("dns listening", "addr", c.LocalAddr(), "mode", b.mode)
+	buf := make([]byte, 512)
+	for {
+		n, from, err := c.ReadFrom(buf)
+		if err != nil {
+			slog.Debug("dns read", "err", err)
+			continue
+		}
+		var m dnsmessage.Message
+		if err := m.Unpack(buf[:n]); err != nil || len(m.Questions) == 0 {
+			slog.Debug("dns could not parse query", "remote", from, "err", err)
+			continue
+		}
+		go func() {
+			resp, ok := b.answer(m)
+			if !ok {
+				return
+			}
+			if _, err := c.WriteTo(resp, from); err != nil {
+				slog.Debug("dns write", "err", err)
+			}
+		}()
+	}
+}
+
+// answer builds the response to q, returning false if it should be dropped.
+func (b dnsBehavior) answer(q dnsmessage.Message) ([]byte, bool) {
+	question := q.Questions[0]
+	mode, delay := b.mode, b.delay
+	label, _, _ := strings.Cut(question.Name.String(), ".")
+	for _, m := range dnsModes {
+		if label == m {
+			mode = m
+		}
+	}
+	if d, ok := strings.CutPrefix(label, "delay-"); ok {
+		if dd, err := time.ParseDuration(d); err == nil {
+			delay = dd
+		}
+	}
+	time.Sleep(delay)
+	if mode == "drop" {
+		return nil, false
+	}
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 q.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   q.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: []dnsmessage.Question{question},
+	}
+	switch mode {
+	case "servfail":
+		resp.RCode = dnsmessage.RCodeServerFailure
+	case "nxdomain":
+		resp.RCode = dnsmessage.RCodeNameError
+	case "truncate":
+		// Claim the answer did not fit, without any answer at all.
+		resp.Truncated = true
+	default:
+		addrs := b.addrs
+		if mode == "rotate" && len(addrs) > 0 {
+			i := int(dnsRotation.Add(1)) % len(addrs)
+			addrs = append(append([]netip.Addr{}, addrs[i:]...), addrs[:i]...)
+		}
+		for _, a := range addrs {
+			h := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 5}
+			switch {
+			case question.Type == dnsmessage.TypeA && a.Is4():
+				h.Type = dnsmessage.TypeA
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: h, Body: &dnsmessage.AResource{A: a.As4()}})
+			case question.Type == dnsmessage.TypeAAAA && a.Is6():
+				h.Type = dnsmessage.TypeAAAA
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: h, Body: &dnsmessage.AAAAResource{AAAA: a.As16()}})
+			}
+		}
+	}
+	p, err := resp.Pack()
+	if err != nil {
+		slog.Warn("dns pack", "err", err)
+		return nil, false
+	}
+	return p, true
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+type echoTLS struct {
+	Version    string `json:"version"`
+	Cipher     string `json:"cipher"`
+	ServerName string `json:"serverName,omitempty"`
+	ALPN       string `json:"alpn,omitempty"`
+	Resumed    bool   `json:"resumed"`
+}
+
+type echoReply struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Proto      string      `json:"proto"`
+	Host       string      `json:"host"`
+	RemoteAddr string      `json:"remoteAddr"`
+	Headers    http.Header `json:"headers"`
+	Trailers   http.Header `json:"trailers,omitempty"`
+	Body       string      `json:"body"`
+	Base64     bool        `json:"base64,omitempty"`
+	TLS        *echoTLS    `json:"tls,omitempty"`
+}
+
+func newEchoTLS(cs *tls.ConnectionState) *echoTLS {
+	return &echoTLS{
+		Version:    tls.VersionName(cs.Version),
+		Cipher:     tls.CipherSuiteName(cs.CipherSuite),
+		ServerName: cs.ServerName,
+		ALPN:       cs.NegotiatedProtocol,
+		Resumed:    cs.DidResume,
+	}
+}
+
+// echo replies with a JSON description of the request after delay. The
+// body is base64 encoded when base64=true or when it is not valid UTF-8.
+func echo(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	time.Sleep(timeQueryParam(q, "delay", 0))
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Debug("/echo read", "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e := echoReply{
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Proto:      r.Proto,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		Headers:    r.Header,
+		Trailers:   r.Trailer,
+		Body:       string(body),
+	}
+	if q.Get("base64") == "true" || !utf8.Valid(body) {
+		e.Body, e.Base64 = base64.StdEncoding.EncodeToString(body), true
+	}
+	if cs := r.TLS; cs != nil {
+		e.TLS = newEchoTLS(cs)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(e)
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// endpointDoc describes an endpoint for the help text of / and for
+// /openapi.json.
+type endpointDoc struct {
+	path    string   // such as /bytes/<n>
+	summary string   // what the endpoint does
+	params  []string // query params, each optionally followed by a note in parentheses
+}
+
+// docs are the documented endpoints, in the order they were registered.
+var docs []endpointDoc
+
+// handle registers h on mux at path, up to any <parameter> in it, and
+// documents it there unless summary is empty, so that the help text and
+// /openapi.json describe exactly what is served.
+func handle(mux *http.ServeMux, path string, h http.Handler, summary string, params ...string) {
+	pattern, _, _ := strings.Cut(path, "<")
+	mux.Handle(pattern, h)
+	if summary != "" {
+		docs = append(docs, endpointDoc{path: path, summary: summary, params: params})
+	}
+}
+
+func handleFunc(mux *http.ServeMux, path string, h http.HandlerFunc, summary string, params ...string) {
+	handle(mux, path, h, summary, params...)
+}
+
+// help returns the line of help text for d.
+func (d endpointDoc) help() string {
+	switch len(d.params) {
+	case 0:
+		return fmt.Sprintf("\t%s - %s\n", d.path, d.summary)
+	case 1:
+		return fmt.Sprintf("\t%s - %s - accepts query param: %s\n", d.path, d.summary, d.params[0])
+	}
+	return fmt.Sprintf("\t%s - %s - accepts query params: %s\n", d.path, d.summary, strings.Join(d.params, ", "))
+}
+
+type openAPIParam struct {
+	Name        string            `json:"name"`
+	In          string            `json:"in"`
+	Required    bool              `json:"required,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Schema      map[string]string `json:"schema"`
+}
+
+type openAPIOperation struct {
+	Summary    string                       `json:"summary"`
+	Parameters []openAPIParam               `json:"parameters,omitempty"`
+	Responses  map[string]map[string]string `json:"responses"`
+}
+
+// openAPI serves an OpenAPI 3 description of the documented endpoints. Any
+// method is accepted everywhere, but only GET is described.
+func openAPI(w http.ResponseWriter, r *http.Request) {
+	paths := make(map[string]map[string]openAPIOperation)
+	for _, d := range docs {
+		op := openAPIOperation{
+			Summary:   d.summary,
+			Responses: map[string]map[string]string{"default": {"description": "whatever misbehavior was asked for"}},
+		}
+		path := d.path
+		if before, name, ok := strings.Cut(path, "<"); ok {
+			name = strings.TrimSuffix(name, ">")
+			path = before + "{" + name + "}"
+			op.Parameters = append(op.Parameters, openAPIParam{Name: name, In: "path", Required: true, Schema: map[string]string{"type": "string"}})
+		}
+		for _, p := range d.params {
+			name, note, _ := strings.Cut(p, " ")
+			op.Parameters = append(op.Parameters, openAPIParam{
+				Name:        name,
+				In:          "query",
+				Description: strings.TrimSuffix(strings.TrimPrefix(note, "("), ")"),
+				Schema:      map[string]string{"type": "string"},
+			})
+		}
+		paths[path] = map[string]openAPIOperation{"get": op}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":       "slowserver",
+			"description": "an intentionally misbehaving server for testing HTTP clients and proxies",
+			"version":     "1",
+		},
+		"paths": paths,
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// headerFaults wraps h so that a client can ask for faults on any request,
+// much like Envoy's fault filter:
+//
+//	X-Slow-Delay: 3s    delay the request
+//	X-Slow-Abort: 50%   abort that share of requests, 100% if only a status is given
+//	X-Slow-Status: 503  status of aborted requests, 503 if only a share is given
+func headerFaults(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get("X-Slow-Delay"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				slog.Warn("couldn't parse X-Slow-Delay", "value", v, "err", err)
+			} else {
+				noteFault(r, "delay")
+				time.Sleep(d)
+			}
+		}
+		abort, status := r.Header.Get("X-Slow-Abort"), r.Header.Get("X-Slow-Status")
+		if abort == "" && status == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		p, code := 1.0, http.StatusServiceUnavailable
+		if abort != "" {
+			p = percent(abort)
+		}
+		if status != "" {
+			c, err := strconv.Atoi(status)
+			if err != nil || c < 100 || c > 999 {
+				slog.Warn("couldn't parse X-Slow-Status", "value", status, "err", err)
+			} else {
+				code = c
+			}
+		}
+		if rng.Float64() < p {
+			noteFault(r, "abort")
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// flakyCounts counts requests per client and flaky configuration.
+var flakyCounts = struct {
+	sync.Mutex
+	m map[string]int
+}{m: make(map[string]int)}
+
+// flaky fails deterministically per client. With the fail query param it
+// fails the first fail requests and then succeeds; with seq, a pattern such
+// as FFFSS, request n passes or fails as the nth letter says, repeating.
+// Clients are identified by the header named by the key query param,
+// -bucketHeader or the client IP. Failures answer with status, 503 by
+// default, and reset=true starts the client's count over.
+func flaky(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	seq := strings.ToUpper(q.Get("seq"))
+	fail := intQueryParam(q, "fail", 0)
+	status := intQueryParam(q, "status", http.StatusServiceUnavailable)
+	if strings.Trim(seq, "FS") != "" {
+		http.Error(w, "seq may only contain F and S", http.StatusBadRequest)
+		return
+	}
+	if status < 100 || status > 999 {
+		http.Error(w, "status must be a status code from 100 to 999", http.StatusBadRequest)
+		return
+	}
+	key := q.Get("key")
+	if key == "" {
+		key = bucketHeader
+	}
+	id := fmt.Sprintf("%s fail=%d seq=%s", clientKey(r, key), fail, seq)
+	flakyCounts.Lock()
+	if q.Get("reset") == "true" {
+		delete(flakyCounts.m, id)
+	}
+	n := flakyCounts.m[id]
+	flakyCounts.m[id] = n + 1
+	flakyCounts.Unlock()
+
+	failed := n < fail
+	if seq != "" {
+		failed = seq[n%len(seq)] == 'F'
+	}
+	w.Header().Set("X-Flaky-Attempt", fmt.Sprint(n+1))
+	if failed {
+		noteFault(r, "flaky")
+		http.Error(w, fmt.Sprintf("attempt %d failed", n+1), status)
+		return
+	}
+	fmt.Fprintf(w, "attempt %d succeeded\n", n+1)
+}
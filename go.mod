@@ -2,8 +2,19 @@ module github.com/jrwren/slowserver
 
 go 1.21
 
-require golang.org/x/net v0.0.0-20220802222814-0bcc04d9c69b
+require golang.org/x/net v0.26.0
 
 require golang.org/x/exp v0.0.0-20221114191408-850992195362
 
-require github.com/gorilla/websocket v1.5.0
+require (
+	github.com/gorilla/websocket v1.5.0
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.33.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
@@ -0,0 +1,348 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// graphQL answers a small subset of GraphQL: a single query whose fields all
+// resolve to placeholder values. Misbehavior is requested in the query:
+//
+//   - the delayMs variable delays the whole response
+//   - the partial variable set to true fails every other top level field
+//   - the @delay(ms: n) directive delays resolving a field
+//   - the @error(message: "...") directive fails a field
+//
+// For example:
+//
+//	query($delayMs: Int) { user { name email @delay(ms: 500) } orders @error }
+func graphQL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		if v := r.URL.Query().Get("variables"); v != "" {
+			json.Unmarshal([]byte(v), &req.Variables)
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "could not decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "GET or POST a query", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	p := &gqlParser{s: req.Query}
+	sel, err := p.document()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"errors": []gqlError{{Message: err.Error()}},
+		})
+		return
+	}
+	if ms, ok := req.Variables["delayMs"].(float64); ok {
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+	}
+	partial, _ := req.Variables["partial"].(bool)
+	res := &gqlResult{vars: req.Variables}
+	data := res.resolve(sel, nil, partial)
+	resp := map[string]any{"data": data}
+	if len(res.errors) > 0 {
+		resp["errors"] = res.errors
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+type gqlField struct {
+	alias, name string
+	args        map[string]any
+	directives  map[string]map[string]any
+	sel         []*gqlField
+}
+
+type gqlError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+type gqlResult struct {
+	vars   map[string]any
+	errors []gqlError
+}
+
+// resolve builds the data for sel, failing alternate fields if partial.
+func (res *gqlResult) resolve(sel []*gqlField, path []any, partial bool) map[string]any {
+	data := make(map[string]any)
+	for i, f := range sel {
+		key := f.alias
+		if key == "" {
+			key = f.name
+		}
+		p := append(append([]any{}, path...), key)
+		if d, ok := f.directives["delay"]; ok {
+			ms, _ := res.value(d["ms"]).(float64)
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+		}
+		if e, ok := f.directives["error"]; ok || partial && i%2 == 1 {
+			msg, _ := res.value(e["message"]).(string)
+			if msg == "" {
+				msg = "injected error resolving " + key
+			}
+			res.errors = append(res.errors, gqlError{Message: msg, Path: p})
+			data[key] = nil
+			continue
+		}
+		switch {
+		case f.sel != nil:
+			data[key] = res.resolve(f.sel, p, false)
+		case f.name == "__typename":
+			data[key] = "Query"
+		case f.name == "now":
+			data[key] = time.Now().Format(time.RFC3339Nano)
+		default:
+			if v, ok := f.args["value"]; ok {
+				data[key] = res.value(v)
+			} else {
+				data[key] = f.name
+			}
+		}
+	}
+	return data
+}
+
+// gqlVar is a reference to a query variable.
+type gqlVar string
+
+func (res *gqlResult) value(v any) any {
+	if n, ok := v.(gqlVar); ok {
+		return res.vars[string(n)]
+	}
+	return v
+}
+
+// gqlParser is a recursive descent parser for the subset of GraphQL that
+// graphQL understands. Fragments, mutations and subscriptions are not.
+type gqlParser struct {
+	s   string
+	pos int
+}
+
+func (p *gqlParser) skip() {
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '#':
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == ',' || unicode.IsSpace(rune(c)):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *gqlParser) peek() byte {
+	p.skip()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *gqlParser) expect(c byte) error {
+	if p.peek() != c {
+		return fmt.Errorf("expected %q at offset %d", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := rune(p.s[p.pos])
+		if c != '_' && !unicode.IsLetter(c) && !(p.pos > start && unicode.IsDigit(c)) {
+			break
+		}
+		p.pos++
+	}
+	if start == p.pos {
+		return "", fmt.Errorf("expected a name at offset %d", p.pos)
+	}
+	return p.s[start:p.pos], nil
+}
+
+func (p *gqlParser) document() ([]*gqlField, error) {
+	if p.peek() != '{' {
+		op, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if op != "query" {
+			return nil, fmt.Errorf("only queries are supported, not %s", op)
+		}
+		if c := p.peek(); c != '{' && c != '(' {
+			if _, err := p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if p.peek() == '(' {
+			// Variable definitions only matter to a real type checker.
+			for depth := 0; ; p.pos++ {
+				if p.pos >= len(p.s) {
+					return nil, fmt.Errorf("unterminated variable definitions")
+				}
+				if p.s[p.pos] == '(' {
+					depth++
+				} else if p.s[p.pos] == ')' {
+					if depth--; depth == 0 {
+						p.pos++
+						break
+					}
+				}
+			}
+		}
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != 0 {
+		return nil, fmt.Errorf("unexpected input at offset %d", p.pos)
+	}
+	return sel, nil
+}
+
+func (p *gqlParser) selectionSet() ([]*gqlField, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	var sel []*gqlField
+	for p.peek() != '}' {
+		if p.peek() == 0 {
+			return nil, fmt.Errorf("unterminated selection set")
+		}
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, f)
+	}
+	p.pos++
+	return sel, nil
+}
+
+func (p *gqlParser) field() (*gqlField, error) {
+	n, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f := &gqlField{name: n, directives: make(map[string]map[string]any)}
+	if p.peek() == ':' {
+		p.pos++
+		f.alias = n
+		if f.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek() == '(' {
+		if f.args, err = p.arguments(); err != nil {
+			return nil, err
+		}
+	}
+	for p.peek() == '@' {
+		p.pos++
+		d, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		f.directives[d] = nil
+		if p.peek() == '(' {
+			if f.directives[d], err = p.arguments(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if p.peek() == '{' {
+		if f.sel, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *gqlParser) arguments() (map[string]any, error) {
+	p.pos++ // (
+	args := make(map[string]any)
+	for p.peek() != ')' {
+		n, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		if args[n], err = p.value(); err != nil {
+			return nil, err
+		}
+	}
+	p.pos++
+	return args, nil
+}
+
+func (p *gqlParser) value() (any, error) {
+	switch c := p.peek(); {
+	case c == '$':
+		p.pos++
+		n, err := p.name()
+		return gqlVar(n), err
+	case c == '"':
+		end := p.pos + 1
+		for end < len(p.s) && p.s[end] != '"' {
+			if p.s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.s) {
+			return nil, fmt.Errorf("unterminated string at offset %d", p.pos)
+		}
+		s, err := strconv.Unquote(p.s[p.pos : end+1])
+		p.pos = end + 1
+		return s, err
+	case c == '-' || c >= '0' && c <= '9':
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.s) && strings.IndexByte("0123456789.eE+-", p.s[p.pos]) >= 0 {
+			p.pos++
+		}
+		return strconv.ParseFloat(p.s[start:p.pos], 64)
+	default:
+		n, err := p.name()
+		switch n {
+		case "true":
+			return true, err
+		case "false":
+			return false, err
+		case "null":
+			return nil, err
+		}
+		return n, err
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// The slow gRPC service is described by hand rather than generated, so any
+// client can call it with google.protobuf.StringValue messages:
+//
+//	service slowserver.Slow {
+//	  rpc Unary(google.protobuf.StringValue) returns (google.protobuf.StringValue);
+//	  rpc Stream(google.protobuf.StringValue) returns (stream google.protobuf.StringValue);
+//	}
+//
+// Each call is configured by request metadata:
+//
+//	x-slow-delay          wait before responding
+//	x-slow-count          number of stream messages (default 10)
+//	x-slow-interval       wait between stream messages (default 1s)
+//	x-slow-stall-after    stall the stream after this many messages
+//	x-slow-stall          how long to stall (default 1m)
+//	x-slow-trailer-delay  wait after the last message before the trailers
+//	x-slow-code           status code to end the call with
+//	x-slow-message        status message to end the call with
+var slowServiceDesc = grpc.ServiceDesc{
+	ServiceName: "slowserver.Slow",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Unary",
+		Handler:    grpcUnary,
+	}},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Stream",
+		Handler:       grpcStream,
+		ServerStreams: true,
+	}},
+}
+
+// serveGRPC serves the slow gRPC service on addr.
+func serveGRPC(addr string) {
+	l, err := listen("grpc", addr)
+	if err != nil {
+		fatal("grpc listen", "err", err)
+	}
+	l = pausable(l)
+	s := grpc.NewServer()
+	s.RegisterService(&slowServiceDesc, struct{}{})
+	slog.Info("grpc listening", "addr", l.Addr())
+	fatal("grpc serve", "err", s.Serve(l))
+}
+
+// grpcCall is the behavior requested by a call's metadata.
+type grpcCall struct {
+	delay, interval, stall, trailerDelay time.Duration
+	count, stallAfter                    int
+	code                                 codes.Code
+	message                              string
+}
+
+func newGRPCCall(ctx context.Context) grpcCall {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(k string) string {
+		if v := md.Get(k); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	dur := func(k string, d time.Duration) time.Duration {
+		if v := get(k); v != "" {
+			if t, err := time.ParseDuration(v); err == nil {
+				return t
+			}
+			slog.Warn("couldn't parse grpc metadata", "key", k, "value", v)
+		}
+		return d
+	}
+	num := func(k string, i int) int {
+		if v := get(k); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				return n
+			}
+			slog.Warn("couldn't parse grpc metadata", "key", k, "value", v)
+		}
+		return i
+	}
+	return grpcCall{
+		delay:        dur("x-slow-delay", 0),
+		interval:     dur("x-slow-interval", time.Second),
+		stall:        dur("x-slow-stall", time.Minute),
+		trailerDelay: dur("x-slow-trailer-delay", 0),
+		count:        num("x-slow-count", 10),
+		stallAfter:   num("x-slow-stall-after", -1),
+		code:         codes.Code(num("x-slow-code", int(codes.OK))),
+		message:      get("x-slow-message"),
+	}
+}
+
+func (c grpcCall) err() error {
+	if c.code == codes.OK {
+		return nil
+	}
+	return status.Error(c.code, c.message)
+}
+
+// sleep waits for d unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func grpcUnary(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	c := newGRPCCall(ctx)
+	if err := sleep(ctx, c.delay); err != nil {
+		return nil, err
+	}
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+func grpcStream(_ any, stream grpc.ServerStream) error {
+	in := new(wrapperspb.StringValue)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	ctx := stream.Context()
+	c := newGRPCCall(ctx)
+	if err := sleep(ctx, c.delay); err != nil {
+		return err
+	}
+	for i := 0; i < c.count; i++ {
+		if i == c.stallAfter {
+			if err := sleep(ctx, c.stall); err != nil {
+				return err
+			}
+		} else if i > 0 {
+			if err := sleep(ctx, c.interval); err != nil {
+				return err
+			}
+		}
+		msg := wrapperspb.String(in.GetValue() + " " + strconv.Itoa(i))
+		if err := stream.SendMsg(msg); err != nil {
+			return err
+		}
+	}
+	if err := sleep(ctx, c.trailerDelay); err != nil {
+		return err
+	}
+	return c.err()
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// pushFlood issues count HTTP/2 server pushes before writing its own body.
+// With hang=true the pushed resources never finish. Push is only supported
+// on HTTP/2 connections, so this is only useful on the https port.
+func pushFlood(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	count := intQueryParam(r.Form, "count", 1000)
+	hang := r.Form.Get("hang") == "true"
+	p, ok := w.(http.Pusher)
+	if !ok {
+		http.Error(w, "server push requires HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	pushed := 0
+	for i := 0; i < count; i++ {
+		target := "/h2/pushed?i=" + strconv.Itoa(i)
+		if hang {
+			target += "&hang=true"
+		}
+		if err := p.Push(target, nil); err != nil {
+			slog.Debug("/h2/pushflood push failed", "push", i, "err", err)
+			break
+		}
+		pushed++
+	}
+	slog.Info("/h2/pushflood done", "pushed", pushed, "count", count)
+	fmt.Fprintf(w, "pushed %d of %d resources\n", pushed, count)
+}
+
+// pushed is the target of pushFlood. With hang=true it writes half of the
+// declared body and then blocks until the client goes away.
+func pushed(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	body := "pushed resource " + r.Form.Get("i") + "\n"
+	w.Header().Set("Content-Type", "text/plain")
+	if r.Form.Get("hang") != "true" {
+		io.WriteString(w, body)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)*2))
+	io.WriteString(w, body)
+	w.(http.Flusher).Flush()
+	<-r.Context().Done()
+}
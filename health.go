@@ -0,0 +1,95 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthProbe is the state behind /healthz or /readyz. It is up unless an
+// operator forced it down, or it is flapping: down for flapFor at the end of
+// every flapEvery.
+type healthProbe struct {
+	mu        sync.Mutex
+	forced    string // "", "up" or "down"
+	flapEvery time.Duration
+	flapFor   time.Duration
+	since     time.Time
+}
+
+var healthProbes = map[string]*healthProbe{
+	"healthz": {},
+	"readyz":  {},
+}
+
+func (p *healthProbe) up() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.forced != "":
+		return p.forced == "up"
+	case p.flapEvery > 0:
+		return time.Since(p.since)%p.flapEvery < p.flapEvery-p.flapFor
+	}
+	return true
+}
+
+// serveProbe serves the named health probe.
+func serveProbe(name string) http.HandlerFunc {
+	p := healthProbes[name]
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.up() {
+			http.Error(w, name+" failing", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok\n")
+	}
+}
+
+// adminHealth shows the health probes on GET. On POST it changes the probe
+// named by the probe form value: state forces it up or down or back to auto,
+// and flapEvery with flapFor makes it fail for flapFor every flapEvery.
+func adminHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		p, ok := healthProbes[r.Form.Get("probe")]
+		if !ok {
+			http.Error(w, "probe must be healthz or readyz", http.StatusBadRequest)
+			return
+		}
+		p.mu.Lock()
+		switch s := r.Form.Get("state"); s {
+		case "up", "down":
+			p.forced = s
+		case "auto":
+			p.forced = ""
+		}
+		if r.Form.Has("flapEvery") {
+			p.flapEvery = timeQueryParam(r.Form, "flapEvery", 0)
+			p.flapFor = min(timeQueryParam(r.Form, "flapFor", p.flapEvery/2), p.flapEvery)
+			p.since = time.Now()
+		}
+		slog.Info("health probe changed", "probe", r.Form.Get("probe"), "forced", p.forced,
+			"flapEvery", p.flapEvery, "flapFor", p.flapFor)
+		p.mu.Unlock()
+	}
+	state := make(map[string]any)
+	for name, p := range healthProbes {
+		up := p.up()
+		p.mu.Lock()
+		state[name] = map[string]any{
+			"up":        up,
+			"forced":    p.forced,
+			"flapEvery": p.flapEvery.String(),
+			"flapFor":   p.flapFor.String(),
+		}
+		p.mu.Unlock()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// maxHogMem caps the memory held by all /hog/mem requests together.
+var maxHogMem int64 = 2 << 30
+
+var hoggedMem atomic.Int64
+
+// maxHogDuration caps how long a single /hog/cpu request burns.
+const maxHogDuration = 10 * time.Minute
+
+// memHog allocates size bytes and holds them for hold in the background.
+// Every page is touched so the memory is resident, not just reserved.
+func memHog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	size := sizeQueryParam(q, "size", 256<<20)
+	hold := timeQueryParam(q, "hold", time.Minute)
+	if size <= 0 {
+		http.Error(w, "size must be positive", http.StatusBadRequest)
+		return
+	}
+	if n := hoggedMem.Add(size); n > maxHogMem {
+		hoggedMem.Add(-size)
+		http.Error(w, fmt.Sprintf("refusing to hold %d bytes, %d of -maxHogMem %d already held",
+			size, n-size, maxHogMem), http.StatusInsufficientStorage)
+		return
+	}
+	b := make([]byte, size)
+	for i := 0; i < len(b); i += 4096 {
+		b[i] = 1
+	}
+	slog.Info("holding memory", "bytes", size, "for", hold)
+	go func() {
+		time.Sleep(hold)
+		b[0] = 0 // keep b alive until now
+		hoggedMem.Add(-size)
+		debug.FreeOSMemory()
+		slog.Info("released memory", "bytes", size)
+	}()
+	fmt.Fprintf(w, "holding %d bytes for %s, %d held in total\n", size, hold, hoggedMem.Load())
+}
+
+// cpuHog spins cores goroutines for duration in the background.
+func cpuHog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cores := min(intQueryParam(q, "cores", runtime.NumCPU()), runtime.NumCPU())
+	d := min(timeQueryParam(q, "duration", 30*time.Second), maxHogDuration)
+	if cores <= 0 || d <= 0 {
+		http.Error(w, "cores and duration must be positive", http.StatusBadRequest)
+		return
+	}
+	slog.Info("burning cpu", "cores", cores, "for", d)
+	deadline := time.Now().Add(d)
+	for i := 0; i < cores; i++ {
+		go func() {
+			for time.Now().Before(deadline) {
+				for j := 0; j < 1e6; j++ {
+				}
+			}
+		}()
+	}
+	fmt.Fprintf(w, "burning %d cores for %s\n", cores, d)
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// http10 wraps h so that responses follow HTTP/1.0: a 1.0 status line, no
+// chunked encoding or trailers, and the end of the body marked by closing
+// the connection unless a Content-Length was set.
+func http10(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		c, brw, err := hj.Hijack()
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		hw := &http10Writer{c: c, brw: brw, header: make(http.Header), head: r.Method == http.MethodHead}
+		defer hw.finish()
+		h.ServeHTTP(hw, r)
+	})
+}
+
+type http10Writer struct {
+	c           net.Conn
+	brw         *bufio.ReadWriter
+	header      http.Header
+	head        bool
+	wroteHeader bool
+	hijacked    bool
+}
+
+func (w *http10Writer) Header() http.Header {
+	return w.header
+}
+
+func (w *http10Writer) WriteHeader(code int) {
+	if w.wroteHeader || w.hijacked {
+		return
+	}
+	w.wroteHeader = true
+	w.header.Del("Transfer-Encoding")
+	w.header.Del("Trailer")
+	w.header.Set("Connection", "close")
+	if w.header.Get("Date") == "" {
+		w.header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	fmt.Fprintf(w.brw, "HTTP/1.0 %d %s\r\n", code, http.StatusText(code))
+	w.header.Write(w.brw)
+	w.brw.WriteString("\r\n")
+}
+
+func (w *http10Writer) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.header.Get("Content-Type") == "" {
+			w.header.Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.head {
+		return len(p), nil
+	}
+	return w.brw.Write(p)
+}
+
+func (w *http10Writer) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.brw.Flush()
+}
+
+// Hijack hands over the already hijacked connection.
+func (w *http10Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return w.c, w.brw, nil
+}
+
+func (w *http10Writer) finish() {
+	if w.hijacked {
+		return
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.brw.Flush()
+	w.c.Close()
+}
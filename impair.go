@@ -0,0 +1,205 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// impairment describes network degradation applied to everything written to
+// a client: per write latency with jitter, a bandwidth cap and random stalls.
+type impairment struct {
+	Latency   time.Duration
+	Jitter    time.Duration
+	Bandwidth int64 // bytes per second, 0 is unlimited
+	StallProb float64
+	StallFor  time.Duration
+}
+
+// wanProfiles are named impairments so test matrices can say what they mean.
+var wanProfiles = map[string]impairment{
+	"dialup":     {Latency: 120 * time.Millisecond, Jitter: 20 * time.Millisecond, Bandwidth: 7 << 10},
+	"edge":       {Latency: 300 * time.Millisecond, Jitter: 100 * time.Millisecond, Bandwidth: 30 << 10, StallProb: 0.02, StallFor: 3 * time.Second},
+	"3g":         {Latency: 150 * time.Millisecond, Jitter: 50 * time.Millisecond, Bandwidth: 96 << 10, StallProb: 0.01, StallFor: 2 * time.Second},
+	"4g":         {Latency: 50 * time.Millisecond, Jitter: 20 * time.Millisecond, Bandwidth: 1 << 20},
+	"satellite":  {Latency: 600 * time.Millisecond, Jitter: 50 * time.Millisecond, Bandwidth: 256 << 10, StallProb: 0.005, StallFor: 5 * time.Second},
+	"lossy-wifi": {Latency: 20 * time.Millisecond, Jitter: 80 * time.Millisecond, Bandwidth: 2 << 20, StallProb: 0.05, StallFor: 500 * time.Millisecond},
+}
+
+// globalWan names the wan profile for requests which do not pick their own.
+// Operators set it through the admin /admin/faults endpoint or the console.
+var globalWan atomic.Pointer[string]
+
+func init() {
+	globalWan.Store(new(string))
+}
+
+// setGlobalWan sets globalWan to the profile name, or none if it is empty.
+func setGlobalWan(name string) error {
+	if _, known := wanProfiles[name]; !known && name != "" {
+		return errors.New("unknown wan profile " + name)
+	}
+	globalWan.Store(&name)
+	slog.Info("global wan profile set", "wan", name)
+	return nil
+}
+
+func (im impairment) active() bool {
+	return im != impairment{}
+}
+
+// shaper applies an impairment to a stream of writes. Latency and jitter are
+// only paid by a write following an idle period, like the first packet of a
+// burst, while the bandwidth cap paces every byte.
+type shaper struct {
+	im   impairment
+	last time.Time
+}
+
+// wait sleeps for as long as writing n bytes should take.
+func (s *shaper) wait(n int) {
+	im := s.im
+	var d time.Duration
+	if time.Since(s.last) > im.Latency+im.Jitter {
+		d = im.Latency
+		if im.Jitter > 0 {
+			d += time.Duration(rng.Int63n(int64(im.Jitter)))
+		}
+	}
+	if im.Bandwidth > 0 {
+		d += time.Duration(int64(n) * int64(time.Second) / im.Bandwidth)
+	}
+	if im.StallProb > 0 && rng.Float64() < im.StallProb {
+		d += im.StallFor
+	}
+	time.Sleep(d)
+	s.last = time.Now()
+}
+
+// write writes p with write in pieces of roughly a tenth of a second of
+// bandwidth so that large writes are paced rather than delayed all at once.
+func (s *shaper) write(write func([]byte) (int, error), p []byte) (int, error) {
+	chunk := len(p)
+	if s.im.Bandwidth > 0 {
+		chunk = max(int(s.im.Bandwidth/10), 1)
+	}
+	n := 0
+	for n < len(p) {
+		end := min(n+chunk, len(p))
+		s.wait(end - n)
+		nw, err := write(p[n:end])
+		n += nw
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// requestImpairment picks the impairment for r from the wan profile named by
+// the wan query param or X-Slow-Wan header. The latency, jitter, bandwidth,
+// stall and stallFor query params override individual settings.
+func requestImpairment(r *http.Request) impairment {
+	q := r.URL.Query()
+	name := q.Get("wan")
+	if name == "" {
+		name = r.Header.Get("X-Slow-Wan")
+	}
+	if name == "" {
+		name = *globalWan.Load()
+	}
+	im, ok := wanProfiles[strings.ToLower(name)]
+	if name != "" && !ok {
+		slog.Warn("unknown wan profile", "wan", name)
+	}
+	im.Latency = timeQueryParam(q, "latency", im.Latency)
+	im.Jitter = timeQueryParam(q, "jitter", im.Jitter)
+	im.Bandwidth = sizeQueryParam(q, "bandwidth", im.Bandwidth)
+	im.StallFor = timeQueryParam(q, "stallFor", im.StallFor)
+	if s := q.Get("stall"); s != "" {
+		im.StallProb = percent(s)
+		if im.StallFor == 0 {
+			im.StallFor = time.Second
+		}
+	}
+	return im
+}
+
+// percent parses "5%" or "0.05" as a probability.
+func percent(s string) float64 {
+	var f float64
+	var err error
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		f, err = strconv.ParseFloat(p, 64)
+		f /= 100
+	} else {
+		f, err = strconv.ParseFloat(s, 64)
+	}
+	if err != nil {
+		slog.Warn("couldn't parse probability", "value", s, "err", err)
+	}
+	return f
+}
+
+// impair wraps h so that responses, including hijacked connections such as
+// websockets, are impaired as selected by requestImpairment.
+func impair(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		im := requestImpairment(r)
+		if !im.active() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		noteFault(r, "impair")
+		h.ServeHTTP(&impairedWriter{ResponseWriter: w, s: &shaper{im: im}}, r)
+	})
+}
+
+type impairedWriter struct {
+	http.ResponseWriter
+	s *shaper
+}
+
+func (w *impairedWriter) Write(p []byte) (int, error) {
+	return w.s.write(w.ResponseWriter.Write, p)
+}
+
+func (w *impairedWriter) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *impairedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *impairedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c, brw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err != nil {
+		return c, brw, err
+	}
+	ic := &impairedConn{Conn: c, s: w.s}
+	brw.Writer.Reset(ic)
+	return ic, brw, nil
+}
+
+// impairedConn is a net.Conn whose writes are impaired.
+type impairedConn struct {
+	net.Conn
+	s *shaper
+}
+
+func (c *impairedConn) Write(p []byte) (int, error) {
+	return c.s.write(c.Conn.Write, p)
+}
+
+func (c *impairedConn) NetConn() net.Conn {
+	return c.Conn
+}
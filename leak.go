@@ -0,0 +1,67 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// leaks holds what /leak/goroutines and /leak/fds have leaked until an
+// operator releases it through the admin /admin/leak endpoint.
+var leaks = struct {
+	sync.Mutex
+	release    chan struct{}
+	goroutines int
+	fds        []*os.File
+}{release: make(chan struct{})}
+
+// leakGoroutines starts n goroutines which block until released.
+func leakGoroutines(w http.ResponseWriter, r *http.Request) {
+	n := intQueryParam(r.URL.Query(), "n", 1000)
+	leaks.Lock()
+	defer leaks.Unlock()
+	for i := 0; i < n; i++ {
+		go func(release chan struct{}) { <-release }(leaks.release)
+	}
+	leaks.goroutines += n
+	slog.Info("leaked goroutines", "n", n)
+	fmt.Fprintf(w, "leaked %d goroutines, %d in total\n", n, leaks.goroutines)
+}
+
+// leakFDs opens n file descriptors and never closes them until released.
+func leakFDs(w http.ResponseWriter, r *http.Request) {
+	n := intQueryParam(r.URL.Query(), "n", 100)
+	leaks.Lock()
+	defer leaks.Unlock()
+	for i := 0; i < n; i++ {
+		f, err := os.Open(os.DevNull)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("leaked %d file descriptors, %d in total, then %v",
+				i, len(leaks.fds), err), http.StatusInternalServerError)
+			return
+		}
+		leaks.fds = append(leaks.fds, f)
+	}
+	slog.Info("leaked file descriptors", "n", n)
+	fmt.Fprintf(w, "leaked %d file descriptors, %d in total\n", n, len(leaks.fds))
+}
+
+// adminLeak reports leaks on GET and releases them on POST.
+func adminLeak(w http.ResponseWriter, r *http.Request) {
+	leaks.Lock()
+	defer leaks.Unlock()
+	if r.Method == http.MethodPost {
+		close(leaks.release)
+		leaks.release = make(chan struct{})
+		for _, f := range leaks.fds {
+			f.Close()
+		}
+		slog.Info("released leaks", "goroutines", leaks.goroutines, "fds", len(leaks.fds))
+		leaks.goroutines, leaks.fds = 0, nil
+	}
+	fmt.Fprintf(w, "goroutines: %d\nfds: %d\n", leaks.goroutines, len(leaks.fds))
+}
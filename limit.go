@@ -0,0 +1,175 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// connLimit caps the number of connections served across all listeners.
+// Connections over the limit are handled according to overflow:
+// "503" serves them a 503 and closes, "queue" holds them until a slot frees
+// up so latency grows with the queue, and "hang" accepts and never answers.
+type connLimit struct {
+	sem      chan struct{}
+	overflow string
+}
+
+func newConnLimit(n int, overflow string) *connLimit {
+	switch overflow {
+	case "503", "queue", "hang":
+	default:
+		fatal("unknown -maxConnsOverflow", "overflow", overflow)
+	}
+	return &connLimit{sem: make(chan struct{}, n), overflow: overflow}
+}
+
+// listen wraps l so connections it accepts count against the limit.
+func (cl *connLimit) listen(l net.Listener) net.Listener {
+	ll := &limitListener{Listener: l, ready: make(chan net.Conn)}
+	go ll.run(cl)
+	return ll
+}
+
+type limitListener struct {
+	net.Listener
+	ready chan net.Conn
+	err   error
+}
+
+func (l *limitListener) run(cl *connLimit) {
+	defer close(l.ready)
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			return
+		}
+		select {
+		case cl.sem <- struct{}{}:
+			l.ready <- &limitConn{Conn: c, release: func() { <-cl.sem }}
+			continue
+		default:
+		}
+		switch cl.overflow {
+		case "503":
+			l.ready <- &limitConn{Conn: c, over: true}
+		case "queue":
+			go func() {
+				cl.sem <- struct{}{}
+				l.ready <- &limitConn{Conn: c, release: func() { <-cl.sem }}
+			}()
+		case "hang":
+			go func() {
+				io.Copy(io.Discard, c)
+				c.Close()
+			}()
+		}
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	c, ok := <-l.ready
+	if !ok {
+		return nil, l.err
+	}
+	return c, nil
+}
+
+// limitConn gives back its slot when closed. over marks a connection
+// accepted beyond the limit.
+type limitConn struct {
+	net.Conn
+	over    bool
+	release func()
+	once    sync.Once
+}
+
+func (c *limitConn) Close() error {
+	if c.release != nil {
+		c.once.Do(c.release)
+	}
+	return c.Conn.Close()
+}
+
+type overCapacityKey struct{}
+
+// limitConnContext marks the context of connections over the limit for
+// rejectOverCapacity.
+func limitConnContext(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	if lc, ok := c.(*limitConn); ok && lc.over {
+		return context.WithValue(ctx, overCapacityKey{}, true)
+	}
+	return ctx
+}
+
+// rejectOverCapacity wraps h to answer connections over the limit with 503.
+func rejectOverCapacity(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(overCapacityKey{}) != nil {
+			noteFault(r, "overCapacity")
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "server at connection capacity", http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (c *limitConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// bodyLimit wraps h to refuse request bodies over limit bytes, like a strict
+// gateway would. Depending on reject it answers 413, closes the connection
+// without a response or answers 413 after delay. Bodies of unknown length
+// are buffered up to limit to find out.
+func bodyLimit(h http.Handler, limit int64, reject string, delay time.Duration) http.Handler {
+	switch reject {
+	case "413", "close", "slow413":
+	default:
+		fatal("unknown -maxBodyReject", "reject", reject)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		over := r.ContentLength > limit
+		if r.ContentLength < 0 {
+			b, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			over = int64(len(b)) > limit
+			r.Body = io.NopCloser(bytes.NewReader(b))
+		}
+		if !over {
+			h.ServeHTTP(w, r)
+			return
+		}
+		noteFault(r, "bodyLimit")
+		switch reject {
+		case "close":
+			if hj, ok := w.(http.Hijacker); ok {
+				if c, _, err := hj.Hijack(); err == nil {
+					c.Close()
+					return
+				}
+			}
+			panic(http.ErrAbortHandler)
+		case "slow413":
+			time.Sleep(delay)
+		}
+		w.Header().Set("Connection", "close")
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+	})
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listenerProfiles are the personalities available to -listen.
+var listenerProfiles = map[string]string{
+	"normal":      "",
+	"always-slow": "delay=2s",
+	"flaky":       "abort=10%,reset=5%",
+	"down":        "abort=100%",
+	"thin":        "bandwidth=16KB",
+}
+
+// listenSpec is an extra http port serving every request with one profile
+// and emulating a network on every connection.
+type listenSpec struct {
+	port    int
+	profile *rule
+	netem   impairment
+}
+
+// listenSpecs is a repeatable flag such as 8081=always-slow, naming one of
+// listenerProfiles or wanProfiles, or 8083=delay=1s,abort=5%,latency=50ms
+// with rule and netem options.
+type listenSpecs []listenSpec
+
+func (l *listenSpecs) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *listenSpecs) Set(s string) error {
+	port, profile, ok := strings.Cut(s, "=")
+	if !ok {
+		return errors.New("want port=profile")
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return err
+	}
+	opts, known := listenerProfiles[profile]
+	if _, wan := wanProfiles[profile]; wan {
+		opts, known = "wan="+profile, true
+	}
+	if !known {
+		if !strings.Contains(profile, "=") {
+			return errors.New("unknown profile " + profile)
+		}
+		opts = profile
+	}
+	ls := listenSpec{port: n}
+	if ls.netem, opts, err = parseNetem(opts); err != nil {
+		return err
+	}
+	if opts != "" {
+		ls.profile = &rule{Name: profile}
+		if err := ls.profile.parseOptions(opts); err != nil {
+			return err
+		}
+	}
+	*l = append(*l, ls)
+	return nil
+}
+
+type listenerRuleKey struct{}
+
+// withProfile makes the connections of a listener apply profile to every
+// request, ahead of any other rules.
+func withProfile(connContext func(context.Context, net.Conn) context.Context, profile *rule) func(context.Context, net.Conn) context.Context {
+	if profile == nil {
+		return connContext
+	}
+	return func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(connContext(ctx, c), listenerRuleKey{}, profile)
+	}
+}
+
+// httpOptions are the http.Server limits of every httpListener. Zero, the
+// default, is unlimited for timeouts and 1MB for maxHeaderBytes.
+var httpOptions struct {
+	read, readHeader, write, idle time.Duration
+	maxHeaderBytes                int
+	noKeepAlive                   bool
+}
+
+// httpListener is a port serving the http endpoints.
+type httpListener struct {
+	name     string // for socket activation
+	addr     string
+	certfile string // serve TLS if set
+	profile  *rule  // applied to every request if set
+	netem    impairment
+}
+
+// serve serves h with connections counted against cl if it is not nil.
+func (hl httpListener) serve(h http.Handler, cl *connLimit) error {
+	// Load the certificate before listening, while privileges are held.
+	var cfg *tls.Config
+	if hl.certfile != "" {
+		cert, err := tls.LoadX509KeyPair(hl.certfile, hl.certfile)
+		if err != nil {
+			return err
+		}
+		cfg = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	l, err := listen(hl.name, hl.addr)
+	if err != nil {
+		return err
+	}
+	l = netem(pausable(l), hl.netem)
+	srv := &http.Server{
+		Handler:     h,
+		ErrorLog:    slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		ConnContext: withProfile(trackConn, hl.profile),
+		ConnState:   trackConnState,
+
+		ReadTimeout:       httpOptions.read,
+		ReadHeaderTimeout: httpOptions.readHeader,
+		WriteTimeout:      httpOptions.write,
+		IdleTimeout:       httpOptions.idle,
+		MaxHeaderBytes:    httpOptions.maxHeaderBytes,
+		TLSConfig:         cfg,
+	}
+	srv.SetKeepAlivesEnabled(!httpOptions.noKeepAlive)
+	if cl != nil {
+		l = cl.listen(l)
+	}
+	if cfg != nil {
+		return srv.ServeTLS(l, "", "")
+	}
+	return srv.Serve(l)
+}
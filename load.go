@@ -0,0 +1,33 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// inflight counts requests currently being served, not counting upgraded
+// connections such as websockets which would otherwise count forever.
+var inflight atomic.Int64
+
+// loadLatency wraps h so that every request is first delayed by
+// base * (1 + inflight/k), like a saturated backend whose latency grows
+// with the number of requests it is juggling.
+func loadLatency(h http.Handler, base time.Duration, k int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		d := base + base*time.Duration(n-1)/time.Duration(k)
+		w.Header().Set("X-Inflight", strconv.FormatInt(n, 10))
+		noteFault(r, "load")
+		time.Sleep(d)
+		h.ServeHTTP(w, r)
+	})
+}
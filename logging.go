@@ -0,0 +1,139 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// setupLogging makes slog's default logger write format ("text" or "json")
+// at level and above to stderr and to console sessions tailing events.
+func setupLogging(level, format string) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		fatal("bad -logLevel", "err", err)
+	}
+	out := io.MultiWriter(os.Stderr, events)
+	opts := &slog.HandlerOptions{Level: l}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		h = slog.NewTextHandler(out, opts)
+	case "json":
+		h = slog.NewJSONHandler(out, opts)
+	default:
+		fatal("bad -logFormat, want text or json", "format", format)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type faultsKey struct{}
+
+// noteFault records a fault injected into r so that it shows up in the
+// access log.
+func noteFault(r *http.Request, fault string) {
+	if f, ok := r.Context().Value(faultsKey{}).(*[]string); ok {
+		*f = append(*f, fault)
+	}
+}
+
+// accessLog wraps h to log every request with its outcome and any faults
+// noted while serving it, and to count it in the stats of the mux endpoint
+// it is routed to.
+func accessLog(h http.Handler, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		done := statsFor(endpointName(mux, r)).begin(r)
+		var faults []string
+		r = r.WithContext(context.WithValue(r.Context(), faultsKey{}, &faults))
+		lw := &loggingWriter{ResponseWriter: w}
+		// Deferred so that handlers which abort by panicking are logged too.
+		defer func() {
+			done(lw.status, lw.bytes, len(faults))
+			attrs := []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", lw.status,
+				"bytes", lw.bytes,
+				"duration", time.Since(start),
+				"remote", r.RemoteAddr,
+			}
+			if lw.hijacked {
+				attrs = append(attrs, "hijacked", true)
+			}
+			if len(faults) > 0 {
+				attrs = append(attrs, "fault", strings.Join(faults, ","))
+			}
+			slog.Info("request", attrs...)
+		}()
+		h.ServeHTTP(lw, r)
+		if lw.status == 0 && !lw.hijacked {
+			lw.status = http.StatusOK
+		}
+	})
+}
+
+// loggingWriter records the status and body size of a response.
+type loggingWriter struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	hijacked bool
+}
+
+func (w *loggingWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *loggingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *loggingWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *loggingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *loggingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	w.hijacked = true
+	return hj.Hijack()
+}
+
+func (w *loggingWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -7,7 +7,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
@@ -19,7 +19,6 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
-	xnws "golang.org/x/net/websocket"
 )
 
 var (
@@ -27,60 +26,414 @@ var (
 )
 
 func main() {
-	err := os.WriteFile("/run/app.pid", []byte(strconv.Itoa(os.Getpid())), os.ModePerm)
-	if err != nil {
-		log.Println("could not write /run/app.pid")
-	}
 	var httpPort, httpsPort int
 	var certfile, initconns string
+	var vbCount, consolePort, grpcPort, tcpPort, udpPort int
+	var tcpb tcpBehavior
+	var udpb udpBehavior
+	var udpDrop, udpDup, udpReorder string
+	var dnsPort int
+	var dnsb dnsBehavior
+	var dnsAddrs string
+	var redisPort int
+	var redisb redisBehavior
+	var redisPartial, redisDrop string
+	var tarpitPort, tarpitRate int
+	var tarpitProto string
+	var mqttPort int
+	var mqttb mqttBehavior
+	var mqttPingDrop string
+	var tunnelb tunnelBehavior
+	var connectRate, connectAllow string
+	var connectEnabled bool
+	var proxyTo string
+	var rules proxyRules
+	var maxConns int
+	var overflow string
+	var loadBase time.Duration
+	var loadK int
+	var pause string
+	var maxHog, maxStorm string
+	var adminPort int
+	var adminSec adminSecurity
+	var debug bool
+	var logLevel, logFormat string
+	var hosts hostProfiles
+	var bucketBy string
+	var seed int64
+	var extraListens listenSpecs
+	var maxBody, bodyReject string
+	var bodyRejectDelay time.Duration
+	var downgrade bool
+	var mocksFile string
+	var caps sharedCaps
+	var pidfile, runAs string
+	var mirrorTo string
+	var netemOpts string
+	var err error
+	var stormCount, stormSize int
+	var vbHeader, vbDelays string
+	var vbRestartEvery, vbRestartDown time.Duration
 	var gosocket bool
-	flag.BoolVar(&gosocket, "gosocket", false, "serve websocket with golang.org/x/net/websocket insetad of ")
+	flag.BoolVar(&gosocket, "gosocket", false, "deprecated and ignored, websockets are always served with gorilla/websocket")
 	flag.IntVar(&httpPort, "httpPort", 8080, "http listen port")
 	flag.IntVar(&httpsPort, "httpsPort", 8443, "https listen port")
 	flag.StringVar(&certfile, "certfile", "", "certificate file for https")
 	// e.g. -initconns tcpbin.com:4242_35s_"ping\n"
 	// or www.example.net:80_25s_"GET / HTTP/1.1\r\nHost: %s\r\n\r\n"
 	flag.StringVar(&initconns, "initconns", "", "initial remote connections - comma separated host:port_delay_payload pairs")
+	flag.IntVar(&vbCount, "vbackends", 0, "number of virtual backend instances served under /vb/")
+	flag.StringVar(&vbHeader, "vbHeader", "X-Session", "request header hashed to pick a virtual backend")
+	flag.StringVar(&vbDelays, "vbDelays", "", "comma separated response delay per virtual backend")
+	flag.DurationVar(&vbRestartEvery, "vbRestartEvery", 0, "interval between rolling restarts of virtual backends, 0 disables")
+	flag.DurationVar(&vbRestartDown, "vbRestartDown", 10*time.Second, "how long a restarting virtual backend is unavailable")
+	flag.IntVar(&stormCount, "cookieStorm", 0, "number of large cookies and localized headers to set on every response")
+	flag.IntVar(&stormSize, "cookieSize", 256, "size of each cookie set by -cookieStorm")
+	flag.StringVar(&maxStorm, "maxCookieStorm", "1MB", "most cookie bytes the cookieStorm and cookieSize query params may ask for on one response")
+	flag.IntVar(&consolePort, "consolePort", 0, "telnet style operator console listen port, 0 disables; sessions must give -adminToken first if it is set")
+	flag.IntVar(&grpcPort, "grpcPort", 0, "slow gRPC service listen port, 0 disables")
+	flag.IntVar(&tcpPort, "tcpPort", 0, "raw TCP misbehavior listen port, 0 disables")
+	flag.StringVar(&tcpb.mode, "tcpMode", "echo", "raw TCP behavior: echo, drip, blackhole, close or rst")
+	flag.DurationVar(&tcpb.delay, "tcpDelay", time.Second, "raw TCP echo latency or time between drips")
+	flag.IntVar(&tcpb.bytes, "tcpBytes", 1, "raw TCP bytes per drip or bytes read before close")
+	flag.DurationVar(&tcpb.after, "tcpAfter", 5*time.Second, "raw TCP time before rst")
+	flag.IntVar(&udpPort, "udpPort", 0, "UDP echo listen port, 0 disables")
+	flag.DurationVar(&udpb.delay, "udpDelay", 0, "UDP echo delay")
+	flag.StringVar(&udpDrop, "udpDrop", "0", "UDP probability of dropping a datagram, e.g. 5%")
+	flag.StringVar(&udpDup, "udpDup", "0", "UDP probability of duplicating a datagram")
+	flag.StringVar(&udpReorder, "udpReorder", "0", "UDP probability of holding a datagram back behind later ones")
+	flag.DurationVar(&udpb.holdFor, "udpHold", 100*time.Millisecond, "UDP extra delay of datagrams held back by -udpReorder")
+	flag.IntVar(&dnsPort, "dnsPort", 0, "misbehaving DNS server UDP listen port, 0 disables")
+	flag.StringVar(&dnsb.mode, "dnsMode", "answer", "DNS behavior: "+strings.Join(dnsModes, ", "))
+	flag.DurationVar(&dnsb.delay, "dnsDelay", 0, "DNS response delay")
+	flag.StringVar(&dnsAddrs, "dnsAddrs", "127.0.0.1,::1", "comma separated addresses DNS answers with")
+	flag.IntVar(&redisPort, "redisPort", 0, "slow Redis protocol listen port, 0 disables")
+	flag.DurationVar(&redisb.delay, "redisDelay", 0, "Redis reply latency")
+	flag.StringVar(&redisPartial, "redisPartial", "0", "Redis probability of a partial reply followed by a stall, e.g. 5%")
+	flag.DurationVar(&redisb.stall, "redisStall", 30*time.Second, "Redis stall after a partial reply")
+	flag.StringVar(&redisDrop, "redisDrop", "0", "Redis probability of dropping the connection instead of replying")
+	flag.IntVar(&tarpitPort, "tarpitPort", 0, "text protocol tarpit listen port, 0 disables")
+	flag.StringVar(&tarpitProto, "tarpitProto", "smtp", "tarpit protocol banner: smtp, ftp or pop3")
+	flag.IntVar(&tarpitRate, "tarpitRate", 1, "tarpit bytes per second")
+	flag.IntVar(&mqttPort, "mqttPort", 0, "slow MQTT broker listen port, 0 disables")
+	flag.DurationVar(&mqttb.connackDelay, "mqttConnackDelay", 0, "MQTT delay before CONNACK")
+	flag.Float64Var(&mqttb.rate, "mqttRate", 1, "MQTT PUBLISH messages per second to each subscription")
+	flag.StringVar(&mqttPingDrop, "mqttPingDrop", "0", "MQTT probability of not answering a PINGREQ, e.g. 10%")
+	flag.BoolVar(&connectEnabled, "connectProxy", false, "answer CONNECT requests as a forward proxy, letting clients tunnel into the server's network")
+	flag.StringVar(&connectAllow, "connectAllow", "", "comma separated host or host:port destinations -connectProxy may tunnel to, empty allows any")
+	flag.DurationVar(&tunnelb.delay, "connectDelay", 0, "delay before a CONNECT tunnel is established")
+	flag.StringVar(&connectRate, "connectRate", "0", "CONNECT tunnel bytes per second in each direction, e.g. 16KB, 0 is unlimited")
+	flag.DurationVar(&tunnelb.kill, "connectKill", 0, "kill CONNECT tunnels after this long, 0 never")
+	flag.StringVar(&proxyTo, "proxyTo", "", "reverse proxy every request to this upstream URL instead of serving the endpoints")
+	flag.Var(&rules, "proxyRule", "degrade -proxyTo requests, repeatable, e.g. /api:latency=500ms,error=10%,code=502,truncate=5%")
+	flag.IntVar(&maxConns, "maxConns", 0, "maximum concurrent http and https connections, 0 is unlimited")
+	flag.StringVar(&overflow, "maxConnsOverflow", "503", "what happens to connections over -maxConns: 503, queue or hang")
+	flag.DurationVar(&loadBase, "loadBase", 0, "base latency of every request, growing as loadBase*(1+inflight/loadK), 0 disables")
+	flag.IntVar(&loadK, "loadK", 10, "in-flight requests that add another -loadBase of latency")
+	flag.StringVar(&pause, "pause", "", `stop writing on all connections periodically, e.g. "every=30s,for=2s"`)
+	flag.StringVar(&maxHog, "maxHogMem", "2GB", "most memory /hog/mem may hold at once")
+	flag.IntVar(&adminPort, "adminPort", 0, "admin http listen port, 0 disables")
+	flag.StringVar(&adminSec.token, "adminToken", os.Getenv("SLOWSERVER_ADMIN_TOKEN"), "token required by -adminPort as a bearer token or basic auth password and by -consolePort sessions, $SLOWSERVER_ADMIN_TOKEN by default")
+	flag.StringVar(&adminSec.certfile, "adminCertfile", "", "certificate file for https on -adminPort")
+	flag.StringVar(&adminSec.clientCA, "adminClientCA", "", "CA certificates file which -adminPort clients must present certificates from")
+	flag.BoolVar(&debug, "debug", false, "serve pprof and expvar on -adminPort")
+	flag.StringVar(&logLevel, "logLevel", "info", "log level: debug, info, warn or error")
+	flag.StringVar(&logFormat, "logFormat", "text", "log format: text or json")
+	flag.StringVar(&rulesFile, "rules", "", "JSON file of rules applying delay, abort and bandwidth behaviors to matching requests, reloaded on SIGHUP")
+	flag.Var(&hosts, "hostProfile", "behavior for requests to a Host, repeatable, e.g. slow.test:delay=2s or flaky.test:reset=10%")
+	flag.StringVar(&bucketBy, "bucketHeader", "", "request header identifying clients for rules with a clients share, the client IP if empty")
+	flag.Int64Var(&seed, "seed", 0, "seed for the randomness of injected faults so runs can be repeated, 0 picks one")
+	flag.Var(&extraListens, "listen", "extra http port with its own behavior profile, repeatable, e.g. 8081=always-slow, 8082=flaky or 8083=delay=1s,abort=5%")
+	flag.DurationVar(&httpOptions.read, "readTimeout", 0, "http server ReadTimeout, 0 is unlimited")
+	flag.DurationVar(&httpOptions.readHeader, "readHeaderTimeout", 0, "http server ReadHeaderTimeout, 0 is unlimited")
+	flag.DurationVar(&httpOptions.write, "writeTimeout", 0, "http server WriteTimeout, 0 is unlimited")
+	flag.DurationVar(&httpOptions.idle, "idleTimeout", 0, "http server IdleTimeout, 0 is unlimited")
+	flag.IntVar(&httpOptions.maxHeaderBytes, "maxHeaderBytes", 0, "http server MaxHeaderBytes, 0 is the 1MB default")
+	flag.StringVar(&maxBody, "maxBody", "0", "largest request body accepted, e.g. 1MB, 0 is unlimited")
+	flag.StringVar(&bodyReject, "maxBodyReject", "413", "how bodies over -maxBody are refused: 413, close or slow413")
+	flag.DurationVar(&bodyRejectDelay, "maxBodyDelay", 5*time.Second, "delay before a slow413")
+	flag.BoolVar(&httpOptions.noKeepAlive, "noKeepAlive", false, "send every http response with Connection: close")
+	flag.BoolVar(&downgrade, "http10", false, "answer http requests with HTTP/1.0 responses delimited by closing the connection")
+	flag.StringVar(&mocksFile, "mocks", "", "JSON file of mock responses whose headers and bodies are Go templates, read once at startup and not reloaded")
+	flag.Var(&caps, "sharedBandwidth", "bandwidth shared by all requests to an endpoint, repeatable, e.g. /slow=1MB, or * for all endpoints")
+	flag.StringVar(&pidfile, "pidfile", "", "file to write the process id to, none if empty")
+	flag.StringVar(&runAs, "user", "", "user to switch to once listening, e.g. after binding ports below 1024 as root")
+	flag.StringVar(&mirrorTo, "mirrorTo", "", "URL to send a copy of every request to in the background")
+	flag.StringVar(&netemOpts, "netem", "", "network emulation on every http and https connection, e.g. wan=3g or latency=100ms,jitter=20ms,rate=64KB,stall=1%,stallFor=2s")
+	flag.StringVar(&scenariosFile, "scenarios", "", "JSON file of named websocket scenarios for /ws-scenario, reloaded on SIGHUP")
 	flag.Parse()
+	bucketHeader = bucketBy
+	setupLogging(logLevel, logFormat)
+	if gosocket {
+		slog.Warn("-gosocket is deprecated and has no effect")
+	}
+	if pidfile != "" {
+		if err := os.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+			fatal("could not write -pidfile", "err", err)
+		}
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng.seed(seed)
+	slog.Info("random seed", "seed", seed)
+	if rulesFile != "" {
+		if err := loadRules(rulesFile); err != nil {
+			fatal("bad -rules", "err", err)
+		}
+	}
+	go reloadOnHangup()
+	if maxHogMem, err = parseSize(maxHog); err != nil {
+		fatal("bad -maxHogMem", "err", err)
+	}
+	if maxCookieStorm, err = parseSize(maxStorm); err != nil || maxCookieStorm <= 0 {
+		fatal("bad -maxCookieStorm", "err", err)
+	}
+	if pause != "" {
+		every, dur, err := parsePause(pause)
+		if err != nil {
+			fatal("bad -pause", "err", err)
+		}
+		go pauses(every, dur)
+	}
+	if tunnelb.rate, err = parseSize(connectRate); err != nil {
+		fatal("bad -connectRate", "err", err)
+	}
+	if connectAllow != "" {
+		tunnelb.allow = strings.Split(connectAllow, ",")
+	}
+	if mqttPort != 0 {
+		mqttb.pingDrop = percent(mqttPingDrop)
+		binding.Add(1)
+		go serveMQTT(":"+strconv.Itoa(mqttPort), mqttb)
+	}
+	if tarpitPort != 0 {
+		binding.Add(1)
+		go serveTarpit(":"+strconv.Itoa(tarpitPort), tarpitProto, tarpitRate)
+	}
+	if redisPort != 0 {
+		redisb.partial, redisb.drop = percent(redisPartial), percent(redisDrop)
+		binding.Add(1)
+		go serveRedis(":"+strconv.Itoa(redisPort), redisb)
+	}
+	if dnsPort != 0 {
+		dnsb.addrs = parseDNSAddrs(dnsAddrs)
+		binding.Add(1)
+		go serveDNS(":"+strconv.Itoa(dnsPort), dnsb)
+	}
+	if udpPort != 0 {
+		udpb.drop, udpb.dup, udpb.reorder = percent(udpDrop), percent(udpDup), percent(udpReorder)
+		binding.Add(1)
+		go serveUDP(":"+strconv.Itoa(udpPort), udpb)
+	}
+	if tcpPort != 0 {
+		binding.Add(1)
+		go serveTCP(":"+strconv.Itoa(tcpPort), tcpb)
+	}
+	if grpcPort != 0 {
+		binding.Add(1)
+		go serveGRPC(":" + strconv.Itoa(grpcPort))
+	}
+	if debug {
+		if adminPort == 0 {
+			fatal("-debug needs -adminPort")
+		}
+		mountDebug()
+	}
+	if adminPort != 0 {
+		binding.Add(1)
+		go serveAdmin(":"+strconv.Itoa(adminPort), adminSec)
+	}
+	if consolePort != 0 {
+		binding.Add(1)
+		go serveConsole(":"+strconv.Itoa(consolePort), adminSec.token)
+	}
 	doinitconns(initconns)
-	log.Print("initialized ", len(conns), " connections")
+	slog.Info("initialized connections", "n", len(conns))
 	r := http.NewServeMux()
 	r.HandleFunc("/", root)
-	r.HandleFunc("/slow", slow)
-	r.HandleFunc("/slam", slam)
-	r.HandleFunc("/slam/headers", headerSlam)
-	r.HandleFunc("/slam/body", bodySlam)
-	r.HandleFunc("/connections", connections)
-	r.HandleFunc("/headers", headers)
-	r.Handle("/gs-echo", xnws.Handler(echoServerXNWS))
-	r.Handle("/gs-pinger", xnws.Handler(pingerXNWS))
-	r.HandleFunc("/ws-echo", echoServer)
-	r.HandleFunc("/ws-pinger", pinger)
-	go func() {
-		if certfile == "" {
-			return
+	handleFunc(r, "/openapi.json", openAPI, "an OpenAPI description of these endpoints")
+	handleFunc(r, "/slow", slow, "responds slowly", "chunk", "delay", "duration", "checksum (header or trailer)", "badChecksum")
+	handleFunc(r, "/slam", slam, "closes the connection without writing headers or body", "duration")
+	handleFunc(r, "/slam/headers", headerSlam, "closes connection after writing headers", "duration")
+	handleFunc(r, "/slam/body", bodySlam, "closes connection after writing 1/2 the body", "duration", "len")
+	handleFunc(r, "/slam/double", doubleSlam, "writes two complete responses to one request", "duration", "hold")
+	handleFunc(r, "/slam/408", timeoutSlam, "reads part of the request body then answers 408 and closes the connection", "read", "duration")
+	handleFunc(r, "/pipeline", pipeline, "answers pipelined requests out of order", "mode (reverse, shuffle, coalesce)", "window", "count")
+	handleFunc(r, "/badheaders", badHeaders, "writes malformed response headers", "mode (invalid, crlf, utf8, long, fold)", "size", "delay")
+	handleFunc(r, "/connections", connections, "list (GET) and create (POST) remote TCP connections")
+	handleFunc(r, "/headers", headers, "respond with headers sent as text body")
+	handleFunc(r, "/echo", echo, "respond with a JSON description of the request", "delay", "base64")
+	handleFunc(r, "/conninfo", conninfo, "respond with a JSON description of the connection, including whether it was reused")
+	handleFunc(r, "/cookies", cookiesList, "respond with the cookies sent as JSON")
+	handleFunc(r, "/cookies/set", cookiesSet, "sets a cookie for each query param", "delay", "path", "domain", "secure", "httpOnly", "sameSite", "maxAge", "ttl", "skew")
+	handleFunc(r, "/cookies/delete", cookiesDelete, "expires the cookies named by the query params", "delay")
+	handleFunc(r, "/session", session, "requires a valid session cookie from /session/login or responds 401", "delay")
+	handleFunc(r, "/session/login", sessionLogin, "slowly issues a session cookie", "delay (default 2s)", "ttl", "skew", "path", "domain", "secure", "httpOnly", "sameSite", "maxAge")
+	handleFunc(r, "/cache", cache, "a cacheable resource answering conditional requests", "mode (correct, never, always, wrong)", "version", "age", "maxAge", "cacheControl", "delay", "notModifiedDelay")
+	handleFunc(r, "/cache/<path>", cache, "a cacheable resource answering conditional requests", "mode (correct, never, always, wrong)", "version", "age", "maxAge", "cacheControl", "delay", "notModifiedDelay")
+	handleFunc(r, "/cors", cors, "answers CORS preflights and requests", "mode (correct, slow, wrong, missing, error)", "delay", "maxAge")
+	handleFunc(r, "/auth/basic", authBasic, "requires basic authentication", "user", "password", "delay", "failDelay", "flaky")
+	handleFunc(r, "/auth/bearer", authBearer, "requires a bearer token", "token", "delay", "failDelay", "flaky")
+	handleFunc(r, "/auth/digest", authDigest, "requires digest authentication", "user", "password", "delay", "failDelay", "flaky")
+	handleFunc(r, "/ratelimit", rateLimit, "a per client token bucket answering 429 when empty, with X-RateLimit headers", "limit", "per")
+	handleFunc(r, "/flaky", flaky, "fails a client's first requests or follows a pass/fail pattern", "fail", "seq (e.g. FFFSS)", "status", "key", "reset")
+	handleFunc(r, "/altsvc", altSvc(httpsPort), "advertises broken Alt-Svc alternatives", "mode (wrongport, h3, tls, clear)", "port", "alt", "ma", "delay")
+	rd := redirector{httpPort: httpPort, httpsPort: httpsPort, blackhole: "10.255.255.1"}
+	if tcpPort != 0 && tcpb.mode == "blackhole" {
+		rd.blackhole = ":" + strconv.Itoa(tcpPort)
+	}
+	handle(r, "/redirect", rd, "redirects slowly, possibly across scheme or port or to a blackhole", "mode (same, scheme, port, blackhole)", "n", "code", "delay", "path", "port")
+	handleFunc(r, "/badtype", badType, "serves a body with the wrong Content-Type or Content-Encoding", "mode (jsonhtml, gzipjson, htmljson, charset, image, none, encoding)", "delay")
+	handleFunc(r, "/bytes/<n>", randomBytes, "exactly n bytes of seeded pseudo-random data", "seed", "chunked", "rate", "checksum", "badChecksum")
+	handleFunc(r, "/tarpit", httpTarpit, "writes the body one byte at a time", "byteDelay", "duration (0 is forever)")
+	handleFunc(r, "/infinite", infinite, "streams data forever without a Content-Length", "rate")
+	handleFunc(r, "/slowheaders", slowHeaders, "writes the status line and each header with a delay between them", "delay", "count")
+	handleFunc(r, "/healthz", serveProbe("healthz"), "a health probe controlled by /admin/health on -adminPort")
+	handleFunc(r, "/readyz", serveProbe("readyz"), "a readiness probe controlled by /admin/health on -adminPort")
+	// /gs-echo and /gs-pinger were served by golang.org/x/net/websocket
+	// and are kept for existing clients.
+	handleFunc(r, "/gs-echo", echoServer, "same as /ws-echo")
+	handleFunc(r, "/gs-pinger", gsPinger, "same as /ws-pinger?text=true")
+	handleFunc(r, "/ws-echo", echoServer, "a websocket connection which echoes lines in response", "delay", "fragment", "fragmentDelay")
+	handleFunc(r, "/ws-pinger", pinger, "a websocket connection which sends ping frames every 10s", "delay", "size", "pongWait", "pong", "text")
+	handleFunc(r, "/ws-firehose", firehose, "a websocket connection which pushes messages regardless of client reads", "rate", "size", "burst")
+	handleFunc(r, "/ws-zombie", zombie, "a websocket connection which never reads", "send", "duration")
+	handleFunc(r, "/ws-close", closer, "a websocket connection closed with an arbitrary code", "code", "after", "message", "tcp")
+	handleFunc(r, "/ws-violate", violate, "a websocket connection which violates RFC 6455", "mode", "after", "wait")
+	handleFunc(r, "/ws-big", bigFrame, "a websocket connection which sends one enormous frame", "frame", "stall")
+	handleFunc(r, "/ws-slowshake", slowShake, "a websocket connection with a slow 101 response", "delay", "trickle", "byteDelay")
+	handleFunc(r, "/ws-reject", reject, "refuses the websocket upgrade", "code", "delay", "body", "header")
+	handleFunc(r, "/ws-subproto", subproto, "a websocket connection with broken subprotocol negotiation", "mode (echo, unoffered, empty, omit)", "proto")
+	handleFunc(r, "/ws-deflate", deflate, "a websocket connection playing permessage-deflate games", "mode (bomb, takeover)", "size", "count", "delay")
+	handleFunc(r, "/ws-room", wsRoom, "a websocket broadcast room", "name", "delay", "lag", "queue")
+	handleFunc(r, "/ws-scenario", wsScenario, "a websocket connection playing a script from -scenarios", "name")
+	handleFunc(r, "/graphql", graphQL, "a slow GraphQL endpoint taking the variables delayMs and partial and the field directives @delay(ms:) and @error(message:)")
+	handleFunc(r, "/hog/mem", memHog, "allocates and holds memory in the background", "size", "hold")
+	handleFunc(r, "/hog/cpu", cpuHog, "spins goroutines to burn CPU in the background", "cores", "duration")
+	handleFunc(r, "/leak/goroutines", leakGoroutines, "leaks goroutines until released with POST /admin/leak on -adminPort", "n")
+	handleFunc(r, "/leak/fds", leakFDs, "leaks file descriptors until released with POST /admin/leak on -adminPort", "n")
+	handleFunc(r, "/h2/pushflood", pushFlood, "issues many HTTP/2 server pushes (https only)", "count", "hang")
+	r.HandleFunc("/h2/pushed", pushed)
+	handleFunc(r, "/tls/tiny", tlsTiny, "writes the response in 1-byte TLS records (https, HTTP/1.1 only; renegotiation and post-handshake auth stalls are not implemented yet)", "size", "byteDelay")
+	if scenariosFile != "" {
+		if err := reloadScenarios(); err != nil {
+			fatal("bad -scenarios", "err", err)
+		}
+	}
+	if mocksFile != "" {
+		ms, err := loadMocks(mocksFile)
+		if err != nil {
+			fatal("bad -mocks", "err", err)
+		}
+		mountMocks(r, ms)
+		slog.Info("loaded mocks", "file", mocksFile, "n", len(ms))
+	}
+	if vbCount > 0 {
+		initVBackends(vbCount, vbDelays)
+		handle(r, "/vb/<endpoint>", vbHandler(r, vbHeader), "any endpoint served by a virtual backend instance (with -vbackends) chosen by hash of -vbHeader")
+		if vbRestartEvery > 0 {
+			go rollingRestarts(vbRestartEvery, vbRestartDown)
+		}
+	}
+	var h http.Handler = r
+	if proxyTo != "" {
+		target, err := url.Parse(proxyTo)
+		if err != nil {
+			fatal("bad -proxyTo", "err", err)
+		}
+		h = reverseProxy(target, rules)
+	}
+	h = cookieStorm(h, stormCount, stormSize)
+	if connectEnabled {
+		h = connectProxy(h, tunnelb)
+	}
+	if n, err := parseSize(maxBody); err != nil {
+		fatal("bad -maxBody", "err", err)
+	} else if n > 0 {
+		h = bodyLimit(h, n, bodyReject, bodyRejectDelay)
+	}
+	h = headerFaults(h)
+	h = ruleEngine(h, hosts)
+	if loadBase > 0 {
+		h = loadLatency(h, loadBase, max(loadK, 1))
+	}
+	var cl *connLimit
+	if maxConns > 0 {
+		cl = newConnLimit(maxConns, overflow)
+		h = rejectOverCapacity(h)
+	}
+	h = impair(h)
+	routes := r
+	if proxyTo != "" {
+		routes = nil
+	}
+	if len(caps) > 0 {
+		h = sharedBandwidth(h, routes, caps)
+	}
+	im, rest, err := parseNetem(netemOpts)
+	if err != nil {
+		fatal("bad -netem", "err", err)
+	}
+	if rest != "" {
+		fatal("unknown -netem options", "options", rest)
+	}
+	if mirrorTo != "" {
+		target, err := url.Parse(mirrorTo)
+		if err != nil {
+			fatal("bad -mirrorTo", "err", err)
 		}
-		err := http.ListenAndServeTLS(":"+strconv.FormatInt(int64(httpsPort), 10),
-			certfile, certfile, r)
-		log.Fatal(err)
-	}()
-	log.Fatal(http.ListenAndServe(":"+strconv.FormatInt(int64(httpPort), 10), r))
+		h = mirror(h, target)
+	}
+	h = countRequests(h)
+	h = accessLog(h, routes)
+	if downgrade {
+		h = http10(h)
+	}
+	for _, ls := range extraListens {
+		binding.Add(1)
+		go func(ls listenSpec) {
+			hl := httpListener{name: "http-" + strconv.Itoa(ls.port), addr: ":" + strconv.Itoa(ls.port), profile: ls.profile, netem: ls.netem}
+			fatal("http serve", "err", hl.serve(h, cl))
+		}(ls)
+	}
+	if certfile != "" {
+		binding.Add(1)
+		go func() {
+			hl := httpListener{name: "https", addr: ":" + strconv.FormatInt(int64(httpsPort), 10), certfile: certfile, netem: im}
+			fatal("https serve", "err", hl.serve(h, cl))
+		}()
+	}
+	binding.Add(1)
+	if runAs != "" {
+		go func() {
+			binding.Wait()
+			if err := dropPrivileges(runAs); err != nil {
+				fatal("could not drop privileges", "user", runAs, "err", err)
+			}
+		}()
+	}
+	hl := httpListener{name: "http", addr: ":" + strconv.FormatInt(int64(httpPort), 10), netem: im}
+	fatal("http serve", "err", hl.serve(h, cl))
 }
 
 func root(w http.ResponseWriter, r *http.Request) {
-	io.WriteString(w, `Endpoints on this server:
-	/slow - responds slowly - accepts query params: chunk, delay, duration
-	/slam - closes the connection without writing headers or body - accepts query param: duration
-	/slam/headers - closes connection after writing headers - accepts query param: duration
-	/slam/body - closes connection after writing 1/2 the body - accepts query param: duration, len
-	/connections - list (GET) and create (POST) remote TCP connections
-	/headers - respond with headers sent as text body
-	/ws-echo - a websocket connection which echoes lines in response
-	/ws-pinger - a websocket connection which pings every 10s - accepts query param: delay
-	/gs-echo - a go websocket connection which echoes lines in response
-	/gs-pinger - a go websocket connection which pings every 10s - accepts query param: delay
-The /gs-echo and /gs-pinger endpoints use golang.org/x/net/websocket which does
-not use data framing as defined in RFC6455.
+	io.WriteString(w, "Endpoints on this server:\n")
+	for _, d := range docs {
+		io.WriteString(w, d.help())
+	}
+	io.WriteString(w, `Any request may carry X-Slow-Delay (e.g. 3s), X-Slow-Abort (e.g. 50%) and
+X-Slow-Status (e.g. 503) headers to ask for a delay or an aborted response.
+With -connectProxy, CONNECT requests open a forward proxy tunnel to the
+destinations in -connectAllow, slowed by -connectDelay, -connectRate and
+-connectKill or the X-Slow-Connect-Delay, -Rate and -Kill proxy headers.
+The /ws- endpoints accept compress=true to negotiate permessage-deflate and level
+to set the compression level.
+Any endpoint accepts the cookieStorm and cookieSize query params to set many
+large cookies and localized headers on its response, up to -maxCookieStorm bytes.
+Any endpoint accepts the wan query param (or X-Slow-Wan header) naming a network
+profile (dialup, edge, 3g, 4g, satellite, lossy-wifi) and the latency, jitter,
+bandwidth, stall and stallFor query params to degrade what it writes.
 	`)
 }
 
@@ -92,6 +445,34 @@ func slam(w http.ResponseWriter, r *http.Request) {
 	panic("slam!")
 }
 
+// doubleSlam writes two complete responses for one request and keeps the
+// connection open for hold, so a client reusing it reads the second one as
+// the answer to its next request.
+func doubleSlam(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	time.Sleep(timeQueryParam(r.Form, "duration", time.Duration(0)))
+	hold := timeQueryParam(r.Form, "hold", 30*time.Second)
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "double responses need HTTP/1.1", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	c, brw, err := hj.Hijack()
+	if err != nil {
+		slog.Warn("double hijack", "err", err)
+		return
+	}
+	defer c.Close()
+	for _, body := range []string{"first response\n", "second response\n"} {
+		fmt.Fprintf(brw, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	if err := brw.Flush(); err != nil {
+		return
+	}
+	c.SetReadDeadline(time.Now().Add(hold))
+	io.Copy(io.Discard, brw)
+}
+
 // headerSlam writes some headers and then closes the connection before writing body.
 func headerSlam(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
@@ -110,7 +491,7 @@ func bodySlam(w http.ResponseWriter, r *http.Request) {
 	ll, err := strconv.Atoi(l)
 	if err != nil {
 		if l != "" {
-			log.Print(err)
+			slog.Warn("couldn't parse len", "err", err)
 		}
 		ll = 512
 	}
@@ -121,13 +502,26 @@ func bodySlam(w http.ResponseWriter, r *http.Request) {
 	time.Sleep(t)
 	f, err := os.Open("/usr/share/dict/words")
 	if err != nil {
-		log.Print("couldn't open /usr/share/dict/words")
+		slog.Error("couldn't open /usr/share/dict/words", "err", err)
 		return
 	}
 	defer f.Close()
 	io.Copy(w, io.LimitReader(f, int64(ll)))
 }
 
+// timeoutSlam reads part of the request body, by default half of it, waits
+// and then gives up on the request with a 408 and closes the connection, as
+// servers do with idle or slow clients.
+func timeoutSlam(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	n := sizeQueryParam(q, "read", max(r.ContentLength/2, 0))
+	io.CopyN(io.Discard, r.Body, n)
+	time.Sleep(timeQueryParam(q, "duration", time.Second))
+	noteFault(r, "slam408")
+	w.Header().Set("Connection", "close")
+	http.Error(w, http.StatusText(http.StatusRequestTimeout), http.StatusRequestTimeout)
+}
+
 func headers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text")
 	for i := range r.Header {
@@ -179,7 +573,7 @@ func connectionsPost(w http.ResponseWriter, r *http.Request) {
 	buf := make([]byte, 1024)
 	n, err := r.Body.Read(buf)
 	if err != nil && err != io.EOF {
-		log.Printf("error reading request body %#v: %s", r, err)
+		slog.Warn("error reading request body", "err", err)
 	}
 	addConnection(string(buf[0:n]))
 	w.WriteHeader(http.StatusAccepted)
@@ -189,11 +583,11 @@ func connectionsDelete(w http.ResponseWriter, r *http.Request) {
 	buf := make([]byte, 1024)
 	n, err := r.Body.Read(buf)
 	if err != nil && err != io.EOF {
-		log.Printf("error reading request body %#v: %s", r, err)
+		slog.Warn("error reading request body", "err", err)
 	}
 	i, err := strconv.Atoi(string(buf[0:n]))
 	if err != nil {
-		log.Printf("error parsing request body %#v: %s", r, err)
+		slog.Warn("error parsing request body", "err", err)
 		http.Error(w, http.StatusText(http.StatusBadRequest),
 			http.StatusBadRequest)
 		return
@@ -206,20 +600,33 @@ func slow(w http.ResponseWriter, r *http.Request) {
 	// We shall return ~1MB total. and use american english dictionary for fun.
 	f, err := os.Open("/usr/share/dict/words")
 	if err != nil {
-		log.Print("couldn't open /usr/share/dict/words")
+		slog.Error("couldn't open /usr/share/dict/words", "err", err)
 		return
 	}
 	defer f.Close()
 	r.ParseForm()
-	help := `query params are chunk, delay, duration, help`
-	if !strings.HasPrefix(r.Form.Get("help"), "n") {
+	help := `query params are chunk, delay, duration, help, checksum, badChecksum`
+	showHelp := !strings.HasPrefix(r.Form.Get("help"), "n")
+	cs := newChecksum(r.Form)
+	if cs.mode != "" {
+		if showHelp {
+			io.WriteString(cs, help)
+		}
+		if _, err := io.Copy(cs, f); err != nil {
+			slog.Error("couldn't read /usr/share/dict/words", "err", err)
+		}
+		f.Seek(0, io.SeekStart)
+		cs.announce(w)
+		defer cs.finish(w)
+	}
+	if showHelp {
 		io.WriteString(w, help)
 	}
 	t := timeQueryParam(r.Form, "duration", 5*time.Minute)
 	delay := timeQueryParam(r.Form, "delay", 2*time.Second)
 	st, err := f.Stat()
 	if err != nil {
-		log.Print("couldn't stat /usr/share/dict/words")
+		slog.Error("couldn't stat /usr/share/dict/words", "err", err)
 		http.Error(w, "could not stat /usr/share/dict/words", 500)
 		return
 	}
@@ -233,11 +640,12 @@ func slow(w http.ResponseWriter, r *http.Request) {
 	if c, err := strconv.ParseInt(r.Form.Get("chunk"), 10, 64); err == nil {
 		chunk = int(c)
 	} else {
-		log.Print("failed to parse chunk query param", r.Form.Get("chunk"))
+		slog.Warn("failed to parse chunk query param", "chunk", r.Form.Get("chunk"))
 	}
-	log.Printf("/slow writing %d every %s for %s", chunk, delay, t)
+	slog.Debug("/slow writing", "chunk", chunk, "every", delay, "for", t)
 	// TODO: consider calculating correct content-length and setting it
-	if t == 5*time.Minute {
+	// Trailers are only sent with chunked encoding.
+	if t == 5*time.Minute && cs.mode != "trailer" {
 		w.Header().Set("content-length", strconv.Itoa(sz))
 	}
 	buf := make([]byte, chunk)
@@ -275,105 +683,209 @@ func slow(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if err != nil {
-		log.Printf("/slow error writing %s", err)
+		slog.Debug("/slow error writing", "err", err)
 	}
 }
 
 var upgrader = websocket.Upgrader{} // use default options
-// Echo the data received on the WebSocket.
+var compressUpgrader = websocket.Upgrader{EnableCompression: true}
+
+// upgrade upgrades r to a websocket, negotiating permessage-deflate if the
+// compress query param is true, at the compression level given by level.
+// Headers already set on w are included in the handshake response.
+func upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	q := r.URL.Query()
+	if q.Get("compress") != "true" {
+		return upgrader.Upgrade(w, r, w.Header())
+	}
+	c, err := compressUpgrader.Upgrade(w, r, w.Header())
+	if err != nil {
+		return c, err
+	}
+	if err := c.SetCompressionLevel(intQueryParam(q, "level", 1)); err != nil {
+		slog.Warn("couldn't set compression level", "err", err)
+	}
+	return c, err
+}
+
+// Echo the data received on the WebSocket. Each echo waits delay and, with
+// fragment=n, is split into n frames with fragmentDelay between them.
 func echoServer(w http.ResponseWriter, r *http.Request) {
-	c, err := upgrader.Upgrade(w, r, nil)
+	r.ParseForm()
+	delay := timeQueryParam(r.Form, "delay", 0)
+	fragment := intQueryParam(r.Form, "fragment", 1)
+	fragmentDelay := timeQueryParam(r.Form, "fragmentDelay", delay)
+	c, err := upgrade(w, r)
 	if err != nil {
-		log.Print("upgrade:", err)
+		slog.Warn("upgrade", "err", err)
 		return
 	}
 	defer c.Close()
 	for {
 		mt, message, err := c.ReadMessage()
 		if err != nil {
-			log.Println("read:", err)
+			slog.Debug("read", "err", err)
 			break
 		}
-		log.Printf("recv: %s", message)
-		err = c.WriteMessage(mt, message)
+		slog.Debug("recv", "message", message)
+		time.Sleep(delay)
+		if fragment > 1 {
+			err = writeFragmented(c.UnderlyingConn(), byte(mt), message, fragment, fragmentDelay)
+		} else {
+			err = c.WriteMessage(mt, message)
+		}
 		if err != nil {
-			log.Println("write:", err)
+			slog.Debug("write", "err", err)
 			break
 		}
 	}
 }
 
+// writeFragmented writes message as n frames, sleeping delay between them.
+func writeFragmented(w io.Writer, opcode byte, message []byte, n int, delay time.Duration) error {
+	size := (len(message) + n - 1) / n
+	for i := 0; i < n; i++ {
+		part := message[min(i*size, len(message)):min((i+1)*size, len(message))]
+		if i > 0 {
+			opcode = opContinuation
+			time.Sleep(delay)
+		}
+		if err := writeFrame(w, i == n-1, opcode, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pinger sends websocket ping control frames every delay. The ping payload
+// is size bytes (at most 125, the control frame limit). If pongWait is set the
+// connection is closed when no pong arrives within pongWait of a ping. With
+// pong=true unsolicited pong frames are sent as well, and with text=true a
+// counter line is written as a text message alongside each ping.
 func pinger(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	delay := timeQueryParam(r.Form, "delay", 10*time.Second)
+	pongWait := timeQueryParam(r.Form, "pongWait", 0)
+	size := min(intQueryParam(r.Form, "size", 0), 125)
+	sendPong := r.Form.Get("pong") == "true"
+	text := r.Form.Get("text") == "true"
 	n := 0
-	c, err := upgrader.Upgrade(w, r, nil)
+	c, err := upgrade(w, r)
 	if err != nil {
-		log.Print("pinger upgrade:", err)
+		slog.Warn("pinger upgrade", "err", err)
 		return
 	}
 	defer c.Close()
+	pongs := make(chan struct{}, 1)
+	c.SetPongHandler(func(string) error {
+		select {
+		case pongs <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	// Control frames are only processed while reading.
+	done := discardReads(c)
+	payload := []byte(strings.Repeat("p", size))
 	for {
-		// TODO: use c.PingHandler()
 		n++
-		err = c.WriteMessage(websocket.TextMessage,
-			[]byte(fmt.Sprintf("%d\n", n)))
+		err = c.WriteControl(websocket.PingMessage, payload, time.Now().Add(delay))
+		if err == nil && sendPong {
+			err = c.WriteControl(websocket.PongMessage, payload, time.Now().Add(delay))
+		}
+		if err == nil && text {
+			err = c.WriteMessage(websocket.TextMessage,
+				[]byte(fmt.Sprintf("%d\n", n)))
+		}
 		if err != nil {
 			if !errors.Is(err, syscall.EPIPE) && err != io.ErrClosedPipe {
-				log.Printf("pinger write error: %s", err)
+				slog.Debug("pinger write", "err", err)
 			}
 			return
 		}
-		time.Sleep(delay)
-	}
-}
-
-// Echo the data received on the WebSocket.
-func echoServerXNWS(ws *xnws.Conn) {
-	io.Copy(ws, ws)
-}
-
-func pingerXNWS(ws *xnws.Conn) {
-	r := ws.Request()
-	r.ParseForm()
-	delay := timeQueryParam(r.Form, "delay", 10*time.Second)
-	buf := make([]byte, 1500)
-	n := 0
-	for {
-		ws.SetReadDeadline(time.Now().Add(1 * time.Second))
-		br, err := ws.Read(buf)
-		if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
-			if errors.Is(err, io.EOF) {
+		if pongWait > 0 {
+			select {
+			case <-pongs:
+			case <-done:
+				return
+			case <-time.After(pongWait):
+				slog.Info("pinger no pong, closing", "within", pongWait)
+				c.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "no pong"),
+					time.Now().Add(time.Second))
 				return
 			}
-			log.Printf("pinger read error: %s %T", err, err)
-			return
-		}
-		if br > 0 {
-			log.Printf("pinger read: %s", buf[:br])
 		}
-		time.Sleep(delay)
-		n++
-		_, err = fmt.Fprintf(ws, "%d\n", n)
-		if err != nil {
-			log.Printf("pinger write error: %s", err)
+		select {
+		case <-done:
 			return
+		case <-time.After(delay):
 		}
 	}
 }
 
+// gsPinger keeps the old /gs-pinger behavior of writing a counter line as a
+// text message every delay.
+func gsPinger(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	q.Set("text", "true")
+	r.URL.RawQuery = q.Encode()
+	pinger(w, r)
+}
+
 func timeQueryParam(v url.Values, name string, t time.Duration) time.Duration {
 	d := v.Get(name)
 	if d != `` {
 		if t2, err := time.ParseDuration(d); err == nil {
 			t = t2
 		} else {
-			log.Print("couldn't parse query parameter", name, d, err)
+			slog.Warn("couldn't parse query parameter", "name", name, "value", d, "err", err)
 		}
 	}
 	return t
 }
 
+func intQueryParam(v url.Values, name string, i int) int {
+	d := v.Get(name)
+	if d != `` {
+		if i2, err := strconv.Atoi(d); err == nil {
+			i = i2
+		} else {
+			slog.Warn("couldn't parse query parameter", "name", name, "value", d, "err", err)
+		}
+	}
+	return i
+}
+
+// sizeQueryParam parses a byte size such as 512, 64KB, 64MB or 2GB.
+func sizeQueryParam(v url.Values, name string, i int64) int64 {
+	d := v.Get(name)
+	if d != `` {
+		if i2, err := parseSize(d); err == nil {
+			i = i2
+		} else {
+			slog.Warn("couldn't parse query parameter", "name", name, "value", d, "err", err)
+		}
+	}
+	return i
+}
+
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	u := strings.ToUpper(s)
+	for _, suf := range []struct {
+		s string
+		m int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(u, suf.s) {
+			u, mult = strings.TrimSuffix(u, suf.s), suf.m
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(u), 10, 64)
+	return n * mult, err
+}
+
 // errInvalidWrite means that a write returned an impossible count.
 var errInvalidWrite = errors.New("invalid write result")
 
@@ -404,7 +916,7 @@ func addConnection(conndef string) error {
 		ds, ps, _ := strings.Cut(after, "_")
 		d, err := time.ParseDuration(ds)
 		if err != nil {
-			log.Print("could not parse ", conndef, err)
+			slog.Warn("could not parse connection", "conn", conndef, "err", err)
 			return err
 		}
 		delay = d
@@ -412,7 +924,7 @@ func addConnection(conndef string) error {
 	}
 	c, err := net.Dial("tcp", addr)
 	if err != nil {
-		log.Print("error connecting to", addr, err)
+		slog.Warn("error connecting", "addr", addr, "err", err)
 		return err
 	}
 	// Do naive \r\n replacement. Sadly, no support for a literal.
@@ -426,7 +938,7 @@ func addConnection(conndef string) error {
 	}
 	i := len(conns)
 	conns = append(conns, conn)
-	log.Printf("parsed connection %#v", conn)
+	slog.Info("parsed connection", "addr", conn.addr, "delay", conn.delay, "payload", conn.payload)
 	go connloop(i, conn)
 	return nil
 }
@@ -437,7 +949,7 @@ func rmConnection(i int) error {
 	}
 	err := conns[i].Close()
 	if err != nil {
-		log.Printf("error closing conn %d %s", i, err)
+		slog.Warn("error closing conn", "conn", i, "err", err)
 		// Intentionally not returning here because we must
 	}
 	// Use nil as sentinel that it has been removed.
@@ -449,11 +961,11 @@ func rmConnection(i int) error {
 func replaceConnection(i int) *Connection {
 	err := conns[i].Close()
 	if err != nil {
-		log.Printf("error closing conn %s", err)
+		slog.Warn("error closing conn", "err", err)
 	}
 	c, err := net.Dial("tcp", conns[i].addr)
 	if err != nil {
-		log.Print("error connecting to", conns[i].addr, err)
+		slog.Warn("error connecting", "addr", conns[i].addr, "err", err)
 	}
 	conns[i] = &Connection{
 		Conn:       c,
@@ -470,24 +982,24 @@ func connloop(i int, c *Connection) {
 	buffer := make([]byte, 1024)
 	for {
 		if c.Conn == nil {
-			log.Print("ending old loop", i, "no connection")
+			slog.Info("ending old loop, no connection", "conn", i)
 			return
 		}
 		n, err := fmt.Fprintf(c, c.payload)
 		if err != nil {
-			log.Printf("error writing to %v: %v", c, err)
+			slog.Warn("error writing", "addr", c.addr, "err", err)
 			c.err = err
 			c = replaceConnection(i)
 			continue
 		}
 		if n == 0 {
-			log.Printf("error 2 writing to %v: write returned 0", c)
+			slog.Warn("error writing, write returned 0", "addr", c.addr)
 			c.err =
 				fmt.Errorf("error 2 writing to %v: write returned 0", c)
 		}
 		n, err = c.Read(buffer)
 		if err != nil {
-			log.Printf("error reading from %v", err)
+			slog.Warn("error reading", "addr", c.addr, "err", err)
 			c.err = fmt.Errorf("error reading from %v: Read returned 0", c)
 			c = replaceConnection(i)
 			continue
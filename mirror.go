@@ -0,0 +1,82 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// mirrorMaxBody is the most of a request body copied to the mirror.
+const mirrorMaxBody = 1 << 20
+
+// mirror wraps h so that a copy of every request is sent to target in the
+// background, with bodies cut at mirrorMaxBody. The mirror's responses are
+// discarded and, if it falls behind by more than 64 requests, copies are
+// dropped rather than slowing anyone down. CONNECT and upgrade requests are
+// not mirrored.
+func mirror(h http.Handler, target *url.URL) http.Handler {
+	sem := make(chan struct{}, 64)
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect || r.Header.Get("Upgrade") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, mirrorMaxBody+1))
+		if err != nil {
+			slog.Debug("mirror read body", "err", err)
+		}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		truncated := len(body) > mirrorMaxBody
+		if truncated {
+			body = body[:mirrorMaxBody]
+		}
+
+		u := *target
+		u.Path = strings.TrimSuffix(target.Path, "/") + r.URL.Path
+		u.RawQuery = r.URL.RawQuery
+		m, err := http.NewRequestWithContext(context.Background(), r.Method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			slog.Warn("mirror request", "err", err)
+			h.ServeHTTP(w, r)
+			return
+		}
+		m.Header = r.Header.Clone()
+		m.Host = r.Host
+		m.Header.Set("X-Slowserver-Mirror", "true")
+		if truncated {
+			m.Header.Set("X-Slowserver-Mirror-Truncated", "true")
+		}
+		select {
+		case sem <- struct{}{}:
+			go func() {
+				defer func() { <-sem }()
+				resp, err := client.Do(m)
+				if err != nil {
+					slog.Debug("mirror", "url", u.String(), "err", err)
+					return
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}()
+		default:
+			slog.Debug("mirror busy, dropped request", "url", u.String())
+		}
+		h.ServeHTTP(w, r)
+	})
+}
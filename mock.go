@@ -0,0 +1,160 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// mock is a response defined in a -mocks file. Headers and Body are Go
+// templates executed with mockData, so that arbitrary APIs can be imitated
+// slowly.
+type mock struct {
+	Path    string            `json:"path"`
+	Method  string            `json:"method,omitempty"`
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Delay   duration          `json:"delay,omitempty"`
+	Body    string            `json:"body"`
+
+	headers map[string]*template.Template
+	body    *template.Template
+	count   atomic.Int64
+}
+
+// mockData is what mock templates can refer to.
+type mockData struct {
+	Request *http.Request
+	Query   url.Values
+	Count   int64     // requests answered by this mock, starting at 1
+	Now     time.Time // when the request arrived
+}
+
+// mockCounters are shared between mocks through the counter template func.
+var mockCounters = struct {
+	sync.Mutex
+	m map[string]int64
+}{m: make(map[string]int64)}
+
+var mockFuncs = template.FuncMap{
+	// counter increments and returns the named counter.
+	"counter": func(name string) int64 {
+		mockCounters.Lock()
+		defer mockCounters.Unlock()
+		mockCounters.m[name]++
+		return mockCounters.m[name]
+	},
+	"header": func(r *http.Request, name string) string {
+		return r.Header.Get(name)
+	},
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"rand": func(n int64) int64 {
+		return rng.Int63n(n)
+	},
+}
+
+func (m *mock) compile() error {
+	if !strings.HasPrefix(m.Path, "/") {
+		return fmt.Errorf("path %q must start with /", m.Path)
+	}
+	if m.Status == 0 {
+		m.Status = http.StatusOK
+	}
+	if m.Status < 100 || m.Status > 999 {
+		return fmt.Errorf("%s: status %d is not from 100 to 999", m.Path, m.Status)
+	}
+	var err error
+	if m.body, err = template.New(m.Path).Funcs(mockFuncs).Parse(m.Body); err != nil {
+		return err
+	}
+	m.headers = make(map[string]*template.Template)
+	for k, v := range m.Headers {
+		if m.headers[k], err = template.New(k).Funcs(mockFuncs).Parse(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMocks reads a JSON array of mocks from file.
+func loadMocks(file string) ([]*mock, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ms []*mock
+	if err := json.NewDecoder(f).Decode(&ms); err != nil {
+		return nil, err
+	}
+	for i, m := range ms {
+		if err := m.compile(); err != nil {
+			return nil, fmt.Errorf("mock %d: %w", i, err)
+		}
+	}
+	return ms, nil
+}
+
+// mountMocks registers ms on mux. Mocks of the same path are told apart by
+// method, and one without a method answers any method.
+func mountMocks(mux *http.ServeMux, ms []*mock) {
+	byPath := make(map[string][]*mock)
+	var paths []string
+	for _, m := range ms {
+		if byPath[m.Path] == nil {
+			paths = append(paths, m.Path)
+		}
+		byPath[m.Path] = append(byPath[m.Path], m)
+	}
+	for _, p := range paths {
+		if _, pattern := mux.Handler(&http.Request{Method: http.MethodGet, URL: &url.URL{Path: p}}); pattern == p {
+			fatal("mock path is already an endpoint", "path", p)
+		}
+		handle(mux, p, mockHandler(byPath[p]), "a mock response from -mocks")
+	}
+}
+
+// mockHandler serves the first of ms whose method matches.
+func mockHandler(ms []*mock) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range ms {
+			if m.Method == "" || strings.EqualFold(m.Method, r.Method) {
+				m.serve(w, r)
+				return
+			}
+		}
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	})
+}
+
+func (m *mock) serve(w http.ResponseWriter, r *http.Request) {
+	d := mockData{Request: r, Query: r.URL.Query(), Count: m.count.Add(1), Now: time.Now()}
+	var body strings.Builder
+	if err := m.body.Execute(&body, d); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for k, t := range m.headers {
+		var v strings.Builder
+		if err := t.Execute(&v, d); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(k, v.String())
+	}
+	time.Sleep(timeQueryParam(d.Query, "delay", time.Duration(m.Delay)))
+	w.WriteHeader(m.Status)
+	w.Write([]byte(body.String()))
+}
@@ -0,0 +1,199 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types.
+const (
+	mqttConnect     = 1
+	mqttConnack     = 2
+	mqttPublish     = 3
+	mqttPuback      = 4
+	mqttSubscribe   = 8
+	mqttSuback      = 9
+	mqttUnsubscribe = 10
+	mqttUnsuback    = 11
+	mqttPingreq     = 12
+	mqttPingresp    = 13
+	mqttDisconnect  = 14
+)
+
+// maxMQTTPacket caps the remaining length of packets clients may send, so
+// that lengths from the wire are never allocated unchecked.
+const maxMQTTPacket = 1 << 20
+
+// mqttBehavior configures the slow MQTT broker.
+type mqttBehavior struct {
+	connackDelay time.Duration
+	rate         float64 // PUBLISH messages per second to each subscriber
+	pingDrop     float64 // probability a PINGREQ goes unanswered
+}
+
+// serveMQTT runs a minimal MQTT broker on addr. It never routes messages
+// between clients, it drips its own PUBLISH messages to subscribed topics.
+func serveMQTT(addr string, b mqttBehavior) {
+	l, err := listen("mqtt", addr)
+	if err != nil {
+		fatal("mqtt listen", "err", err)
+	}
+	l = pausable(l)
+	slog.Info("mqtt listening", "addr", l.Addr())
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			slog.Warn("mqtt accept", "err", err)
+			continue
+		}
+		go b.serve(c)
+	}
+}
+
+// mqttConn serializes writes to a client connection.
+type mqttConn struct {
+	net.Conn
+	mu sync.Mutex
+}
+
+func (c *mqttConn) send(typ, flags byte, body []byte) error {
+	p := []byte{typ<<4 | flags}
+	n := len(body)
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		p = append(p, d)
+		if n == 0 {
+			break
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.Write(append(p, body...))
+	return err
+}
+
+func readMQTTPacket(br *bufio.Reader) (typ, flags byte, body []byte, err error) {
+	h, err := br.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		d, err := br.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		n += int(d&0x7f) * mult
+		if d&0x80 == 0 {
+			break
+		}
+		if mult *= 128; i == 3 {
+			return 0, 0, nil, errors.New("malformed remaining length")
+		}
+	}
+	if n > maxMQTTPacket {
+		return 0, 0, nil, errors.New("packet of " + strconv.Itoa(n) + " bytes is too large")
+	}
+	body = make([]byte, n)
+	_, err = io.ReadFull(br, body)
+	return h >> 4, h & 0xf, body, err
+}
+
+// mqttString encodes s with its length prefix.
+func mqttString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+func (b mqttBehavior) serve(nc net.Conn) {
+	c := &mqttConn{Conn: nc}
+	defer c.Close()
+	br := bufio.NewReader(c)
+	done := make(chan struct{})
+	defer close(done)
+	for {
+		typ, flags, body, err := readMQTTPacket(br)
+		if err != nil {
+			if err != io.EOF {
+				slog.Debug("mqtt read", "err", err)
+			}
+			return
+		}
+		switch typ {
+		case mqttConnect:
+			time.Sleep(b.connackDelay)
+			err = c.send(mqttConnack, 0, []byte{0, 0})
+		case mqttSubscribe:
+			if len(body) < 2 {
+				return
+			}
+			// Grant QoS 0 to every topic filter and start dripping to it.
+			ack := append([]byte{}, body[:2]...)
+			for rest := body[2:]; len(rest) >= 2; {
+				l := int(binary.BigEndian.Uint16(rest))
+				if len(rest) < 3+l {
+					break
+				}
+				topic := string(rest[2 : 2+l])
+				rest = rest[3+l:]
+				ack = append(ack, 0)
+				go b.drip(c, topic, done)
+			}
+			err = c.send(mqttSuback, 0, ack)
+		case mqttUnsubscribe:
+			if len(body) >= 2 {
+				err = c.send(mqttUnsuback, 0, body[:2])
+			}
+		case mqttPublish:
+			// Acknowledge QoS 1 messages, which carry a packet id after the topic.
+			if qos := flags >> 1 & 3; qos == 1 && len(body) >= 2 {
+				l := int(binary.BigEndian.Uint16(body))
+				if len(body) >= 4+l {
+					err = c.send(mqttPuback, 0, body[2+l:4+l])
+				}
+			}
+		case mqttPingreq:
+			if rng.Float64() >= b.pingDrop {
+				err = c.send(mqttPingresp, 0, nil)
+			}
+		case mqttDisconnect:
+			return
+		}
+		if err != nil {
+			slog.Debug("mqtt write", "err", err)
+			return
+		}
+	}
+}
+
+// drip publishes numbered messages to topic at b.rate until done is closed.
+func (b mqttBehavior) drip(c *mqttConn, topic string, done <-chan struct{}) {
+	if b.rate <= 0 {
+		return
+	}
+	t := time.NewTicker(time.Duration(float64(time.Second) / b.rate))
+	defer t.Stop()
+	for n := 1; ; n++ {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		body := append(mqttString(topic), "message "+strconv.Itoa(n)...)
+		if err := c.send(mqttPublish, 0, body); err != nil {
+			return
+		}
+	}
+}
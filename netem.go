@@ -0,0 +1,102 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseNetem picks the network emulation options out of a comma separated
+// list, returning the impairment they describe and the remaining options.
+// The options are wan naming one of wanProfiles, latency, jitter, rate in
+// bytes per second, stall as a probability per write and stallFor.
+func parseNetem(opts string) (im impairment, rest string, err error) {
+	var others []string
+	for _, o := range strings.Split(opts, ",") {
+		k, v, _ := strings.Cut(o, "=")
+		switch k {
+		case "wan":
+			p, ok := wanProfiles[strings.ToLower(v)]
+			if !ok {
+				return im, "", fmt.Errorf("unknown wan profile %q", v)
+			}
+			// Let options before wan= stand.
+			if im.Latency == 0 {
+				im.Latency = p.Latency
+			}
+			if im.Jitter == 0 {
+				im.Jitter = p.Jitter
+			}
+			if im.Bandwidth == 0 {
+				im.Bandwidth = p.Bandwidth
+			}
+			if im.StallProb == 0 {
+				im.StallProb, im.StallFor = p.StallProb, p.StallFor
+			}
+		case "latency", "jitter", "stallFor":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return im, "", err
+			}
+			switch k {
+			case "latency":
+				im.Latency = d
+			case "jitter":
+				im.Jitter = d
+			default:
+				im.StallFor = d
+			}
+		case "rate":
+			if im.Bandwidth, err = parseSize(v); err != nil {
+				return im, "", err
+			}
+		case "stall":
+			if p, ok := strings.CutSuffix(v, "%"); ok {
+				var f float64
+				f, err = strconv.ParseFloat(p, 64)
+				im.StallProb = f / 100
+			} else {
+				im.StallProb, err = strconv.ParseFloat(v, 64)
+			}
+			if err != nil {
+				return im, "", err
+			}
+			if im.StallFor == 0 {
+				im.StallFor = time.Second
+			}
+		default:
+			if o != "" {
+				others = append(others, o)
+			}
+		}
+	}
+	return im, strings.Join(others, ","), nil
+}
+
+// netem wraps l so that writes to every connection it accepts are impaired
+// by im, each connection shaped on its own, like tc netem on the interface
+// but without needing root. Everything served over the connections,
+// websockets and TLS included, is degraded.
+func netem(l net.Listener, im impairment) net.Listener {
+	if !im.active() {
+		return l
+	}
+	return netemListener{l, im}
+}
+
+type netemListener struct {
+	net.Listener
+	im impairment
+}
+
+func (l netemListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &impairedConn{Conn: c, s: &shaper{im: l.im}}, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pausedUntil is non-nil during a stop-the-world pause and is closed when
+// the pause ends.
+var pausedUntil atomic.Pointer[chan struct{}]
+
+// parsePause parses a -pause value such as "every=30s,for=2s".
+func parsePause(s string) (every, dur time.Duration, err error) {
+	for _, o := range strings.Split(s, ",") {
+		k, v, _ := strings.Cut(o, "=")
+		var d time.Duration
+		if d, err = time.ParseDuration(v); err != nil {
+			return 0, 0, err
+		}
+		switch k {
+		case "every":
+			every = d
+		case "for":
+			dur = d
+		default:
+			return 0, 0, errors.New("unknown -pause option " + k)
+		}
+	}
+	if every <= 0 || dur <= 0 {
+		return 0, 0, errors.New("-pause needs every and for")
+	}
+	return every, dur, nil
+}
+
+// pauses stops writes on every pausable connection for dur out of every
+// period, like a GC pause or a VM freeze.
+func pauses(every, dur time.Duration) {
+	for range time.Tick(every) {
+		pauseWorld(dur)
+	}
+}
+
+// pauseMu keeps periodic and operator triggered pauses from overlapping.
+var pauseMu sync.Mutex
+
+// pauseWorld stops writes on every pausable connection for dur.
+func pauseWorld(dur time.Duration) {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	ch := make(chan struct{})
+	pausedUntil.Store(&ch)
+	slog.Info("pausing the world", "for", dur)
+	time.Sleep(dur)
+	pausedUntil.Store(nil)
+	close(ch)
+}
+
+// pausable wraps l so writes to connections it accepts block during pauses.
+func pausable(l net.Listener) net.Listener {
+	return pausableListener{l}
+}
+
+type pausableListener struct {
+	net.Listener
+}
+
+func (l pausableListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return pausableConn{c}, nil
+}
+
+type pausableConn struct {
+	net.Conn
+}
+
+func (c pausableConn) Write(p []byte) (int, error) {
+	if ch := pausedUntil.Load(); ch != nil {
+		<-*ch
+	}
+	return c.Conn.Write(p)
+}
+
+func (c pausableConn) NetConn() net.Conn {
+	return c.Conn
+}
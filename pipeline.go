@@ -0,0 +1,85 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// pipeline hijacks the connection and collects the requests a client
+// pipelines after this one, for up to window or count requests, then answers
+// them all wrongly according to mode: reverse answers them last first,
+// shuffle in random order and coalesce in a single response.
+func pipeline(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	mode := q.Get("mode")
+	if mode == "" {
+		mode = "reverse"
+	}
+	window := timeQueryParam(q, "window", 500*time.Millisecond)
+	count := intQueryParam(q, "count", 10)
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "pipelining needs HTTP/1.1", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	c, brw, err := hj.Hijack()
+	if err != nil {
+		slog.Warn("pipeline hijack", "err", err)
+		return
+	}
+	defer c.Close()
+	reqs := []string{r.Method + " " + r.RequestURI}
+	c.SetReadDeadline(time.Now().Add(window))
+	for len(reqs) < count {
+		pr, err := http.ReadRequest(brw.Reader)
+		if err != nil {
+			break
+		}
+		io.Copy(io.Discard, pr.Body)
+		reqs = append(reqs, pr.Method+" "+pr.RequestURI)
+	}
+	c.SetReadDeadline(time.Time{})
+	slog.Info("/pipeline answering", "mode", mode, "requests", len(reqs))
+	order := make([]int, len(reqs))
+	for i := range order {
+		order[i] = i
+	}
+	switch mode {
+	case "reverse":
+		slices.Reverse(order)
+	case "shuffle":
+		for i := len(order) - 1; i > 0; i-- {
+			j := int(rng.Int63n(int64(i + 1)))
+			order[i], order[j] = order[j], order[i]
+		}
+	case "coalesce":
+		var body bytes.Buffer
+		for _, req := range reqs {
+			fmt.Fprintf(&body, "response to %s\n", req)
+		}
+		writePipelined(brw, reqs[0], body.Bytes())
+		brw.Flush()
+		return
+	default:
+		io.WriteString(brw, "HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+		brw.Flush()
+		return
+	}
+	for _, i := range order {
+		writePipelined(brw, reqs[i], []byte("response to "+reqs[i]+"\n"))
+	}
+	brw.Flush()
+}
+
+func writePipelined(w io.Writer, req string, body []byte) {
+	fmt.Fprintf(w, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nX-Request: %s\r\nContent-Length: %d\r\n\r\n",
+		req, len(body))
+	w.Write(body)
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tunnelBehavior controls CONNECT tunnels: how long establishing one takes,
+// the bytes per second relayed in each direction, when to kill it and which
+// destinations may be tunnelled to.
+type tunnelBehavior struct {
+	delay time.Duration
+	rate  int64
+	kill  time.Duration
+	allow []string // host or host:port destinations, any if empty
+}
+
+// allowed reports whether a tunnel to hostport may be opened.
+func (b tunnelBehavior) allowed(hostport string) bool {
+	if len(b.allow) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	for _, a := range b.allow {
+		if strings.EqualFold(a, hostport) || strings.EqualFold(a, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerOverrides lets a single CONNECT request override b with the
+// X-Slow-Connect-Delay, X-Slow-Connect-Rate and X-Slow-Connect-Kill headers,
+// which clients can send with e.g. curl --proxy-header.
+func (b tunnelBehavior) headerOverrides(h http.Header) tunnelBehavior {
+	if v := h.Get("X-Slow-Connect-Delay"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			b.delay = d
+		} else {
+			slog.Warn("couldn't parse X-Slow-Connect-Delay", "value", v, "err", err)
+		}
+	}
+	if v := h.Get("X-Slow-Connect-Rate"); v != "" {
+		if n, err := parseSize(v); err == nil {
+			b.rate = n
+		} else {
+			slog.Warn("couldn't parse X-Slow-Connect-Rate", "value", v, "err", err)
+		}
+	}
+	if v := h.Get("X-Slow-Connect-Kill"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			b.kill = d
+		} else {
+			slog.Warn("couldn't parse X-Slow-Connect-Kill", "value", v, "err", err)
+		}
+	}
+	return b
+}
+
+// connectProxy wraps h so that CONNECT requests to allowed destinations open
+// slow tunnels as a forward proxy would. Other requests are passed to h.
+func connectProxy(h http.Handler, tb tunnelBehavior) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if !tb.allowed(r.Host) {
+			slog.Warn("tunnel refused", "host", r.Host, "remote", r.RemoteAddr)
+			http.Error(w, "destination not allowed by -connectAllow", http.StatusForbidden)
+			return
+		}
+		b := tb.headerOverrides(r.Header)
+		time.Sleep(b.delay)
+		up, err := net.DialTimeout("tcp", r.Host, 10*time.Second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer up.Close()
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "CONNECT needs HTTP/1.1", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		c, brw, err := hj.Hijack()
+		if err != nil {
+			slog.Warn("hijack", "err", err)
+			return
+		}
+		defer c.Close()
+		if _, err := io.WriteString(brw, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+			return
+		}
+		if err := brw.Flush(); err != nil {
+			return
+		}
+		slog.Info("tunnel", "host", r.Host, "remote", r.RemoteAddr)
+		if b.kill > 0 {
+			t := time.AfterFunc(b.kill, func() {
+				slog.Info("killing tunnel", "host", r.Host, "remote", r.RemoteAddr)
+				c.Close()
+				up.Close()
+			})
+			defer t.Stop()
+		}
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			b.relay(up, brw)
+			up.(*net.TCPConn).CloseWrite()
+		}()
+		go func() {
+			defer wg.Done()
+			b.relay(c, up)
+			c.Close()
+		}()
+		wg.Wait()
+	})
+}
+
+// relay copies src to dst at b.rate bytes per second.
+func (b tunnelBehavior) relay(dst io.Writer, src io.Reader) {
+	if b.rate <= 0 {
+		io.Copy(dst, src)
+		return
+	}
+	s := &shaper{im: impairment{Bandwidth: b.rate}}
+	// The shaper paces the writes, so the buffer need not grow with the
+	// rate, which clients may set.
+	buf := make([]byte, min(max(b.rate/10, 1), 32<<10))
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, err := s.write(dst.Write, buf[:n]); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
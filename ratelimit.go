@@ -0,0 +1,80 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tokenBucket holds up to limit tokens, refilled at limit every per.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// buckets holds a token bucket per client and limit.
+var buckets = struct {
+	sync.Mutex
+	m map[string]*tokenBucket
+}{m: make(map[string]*tokenBucket)}
+
+// takeToken takes a token from the bucket for key if there is one. It
+// returns the tokens left and how long until the bucket is full again and
+// until the next token.
+func takeToken(key string, limit int, per time.Duration) (ok bool, remaining int, reset, retry time.Duration) {
+	rate := float64(limit) / per.Seconds()
+	now := time.Now()
+	buckets.Lock()
+	defer buckets.Unlock()
+	b := buckets.m[key]
+	if b == nil {
+		// Forget full buckets so that the map doesn't grow forever.
+		for k, ob := range buckets.m {
+			if ob.tokens+now.Sub(ob.last).Seconds()*rate >= float64(limit) {
+				delete(buckets.m, k)
+			}
+		}
+		b = &tokenBucket{tokens: float64(limit), last: now}
+		buckets.m[key] = b
+	}
+	b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		ok = true
+	} else {
+		retry = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	reset = time.Duration((float64(limit) - b.tokens) / rate * float64(time.Second))
+	return ok, int(b.tokens), reset, retry
+}
+
+// rateLimit answers requests from each client, identified as for rules by
+// -bucketHeader, until its token bucket of limit requests refilled every
+// per is empty and then with 429s. Responses carry X-RateLimit headers and
+// 429s a Retry-After header.
+func rateLimit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := max(intQueryParam(q, "limit", 10), 1)
+	per := timeQueryParam(q, "per", time.Minute)
+	if per <= 0 {
+		per = time.Minute
+	}
+	key := fmt.Sprintf("%s %d/%s", clientKey(r, bucketHeader), limit, per)
+	ok, remaining, reset, retry := takeToken(key, limit, per)
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(reset.Seconds())), 10))
+	if !ok {
+		noteFault(r, "rateLimit")
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retry.Seconds())), 10))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+	fmt.Fprintf(w, "%d of %d requests left\n", remaining, limit)
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// redirector answers with delayed redirects. blackhole is where redirects to
+// nowhere point: the port of the raw TCP listener in blackhole mode, such as
+// ":9000", or an address which doesn't answer.
+type redirector struct {
+	httpPort, httpsPort int
+	blackhole           string
+}
+
+// ServeHTTP redirects after delay with code, 302 by default, n times to
+// itself and then as mode says:
+//
+//	same      - to path, by default /echo, on this server
+//	scheme    - to path across scheme, https to http or http to https
+//	port      - to path on port with the same scheme
+//	blackhole - to a server which never answers
+func (rd redirector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	time.Sleep(timeQueryParam(q, "delay", 0))
+	code := intQueryParam(q, "code", http.StatusFound)
+	if code < 300 || code > 399 {
+		http.Error(w, "code must be 3xx", http.StatusBadRequest)
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if n := intQueryParam(q, "n", 1); n > 1 {
+		q.Set("n", strconv.Itoa(n-1))
+		http.Redirect(w, r, r.URL.Path+"?"+q.Encode(), code)
+		return
+	}
+	path := q.Get("path")
+	if path == "" {
+		path = "/echo"
+	}
+	var to string
+	switch mode := q.Get("mode"); mode {
+	case "", "same":
+		to = path
+	case "scheme":
+		if scheme == "https" {
+			to = fmt.Sprintf("http://%s%s", net.JoinHostPort(host, strconv.Itoa(rd.httpPort)), path)
+		} else {
+			to = fmt.Sprintf("https://%s%s", net.JoinHostPort(host, strconv.Itoa(rd.httpsPort)), path)
+		}
+	case "port":
+		to = fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, strconv.Itoa(intQueryParam(q, "port", 1))), path)
+	case "blackhole":
+		bh := rd.blackhole
+		if bh[0] == ':' {
+			bh = host + bh
+		}
+		to = (&url.URL{Scheme: "http", Host: bh, Path: path}).String()
+	default:
+		http.Error(w, "unknown mode "+mode, http.StatusBadRequest)
+		return
+	}
+	noteFault(r, "redirect")
+	http.Redirect(w, r, to, code)
+}
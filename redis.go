@@ -0,0 +1,176 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisBehavior configures the slow Redis simulant.
+type redisBehavior struct {
+	delay   time.Duration // latency added to every reply
+	partial float64       // probability a reply is cut short and stalled
+	drop    float64       // probability the connection is dropped instead of replying
+	stall   time.Duration // how long a partial reply stalls before closing
+}
+
+// Limits on what a client may send, as redis has them, so that lengths from
+// the wire are never allocated unchecked.
+const (
+	maxRESPArgs = 1024 * 1024
+	maxRESPBulk = 512 * 1024 * 1024
+)
+
+var (
+	redisMu   sync.Mutex
+	redisData = make(map[string]string)
+)
+
+// serveRedis speaks just enough RESP on addr to answer PING, ECHO, GET, SET
+// and DEL, misbehaving as b says.
+func serveRedis(addr string, b redisBehavior) {
+	l, err := listen("redis", addr)
+	if err != nil {
+		fatal("redis listen", "err", err)
+	}
+	l = pausable(l)
+	slog.Info("redis listening", "addr", l.Addr())
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			slog.Warn("redis accept", "err", err)
+			continue
+		}
+		go b.serve(c)
+	}
+}
+
+func (b redisBehavior) serve(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	for {
+		args, err := readRESP(br)
+		if err != nil {
+			if err != io.EOF {
+				slog.Debug("redis read", "err", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		reply := redisCommand(args)
+		time.Sleep(b.delay)
+		switch {
+		case rng.Float64() < b.drop:
+			return
+		case rng.Float64() < b.partial:
+			c.Write([]byte(reply[:len(reply)/2]))
+			time.Sleep(b.stall)
+			return
+		}
+		if _, err := io.WriteString(c, reply); err != nil {
+			return
+		}
+		if strings.ToUpper(args[0]) == "QUIT" {
+			return
+		}
+	}
+}
+
+// readRESP reads a command, either a RESP array of bulk strings or an inline
+// command as typed into telnet.
+func readRESP(br *bufio.Reader) ([]string, error) {
+	line, err := readRESPLine(br)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxRESPArgs {
+		return nil, fmt.Errorf("bad array length %q", line)
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readRESPLine(br)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("expected bulk string, got %q", line)
+		}
+		l, err := strconv.Atoi(line[1:])
+		if err != nil || l < 0 || l > maxRESPBulk {
+			return nil, fmt.Errorf("bad bulk string length %q", line)
+		}
+		buf := make([]byte, l+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:l]))
+	}
+	return args, nil
+}
+
+func readRESPLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			err = errors.New("unterminated line")
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func bulkString(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+// redisCommand executes args and returns the RESP encoded reply.
+func redisCommand(args []string) string {
+	redisMu.Lock()
+	defer redisMu.Unlock()
+	switch cmd := strings.ToUpper(args[0]); {
+	case cmd == "PING" && len(args) == 1:
+		return "+PONG\r\n"
+	case cmd == "PING" || cmd == "ECHO" && len(args) == 2:
+		return bulkString(args[1])
+	case cmd == "GET" && len(args) == 2:
+		v, ok := redisData[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulkString(v)
+	case cmd == "SET" && len(args) >= 3:
+		redisData[args[1]] = args[2]
+		return "+OK\r\n"
+	case cmd == "DEL" && len(args) >= 2:
+		n := 0
+		for _, k := range args[1:] {
+			if _, ok := redisData[k]; ok {
+				delete(redisData, k)
+				n++
+			}
+		}
+		return ":" + strconv.Itoa(n) + "\r\n"
+	case cmd == "QUIT":
+		return "+OK\r\n"
+	case cmd == "COMMAND":
+		// redis-cli asks for command docs on startup.
+		return "*0\r\n"
+	default:
+		return "-ERR unknown command or wrong number of arguments for '" + args[0] + "'\r\n"
+	}
+}
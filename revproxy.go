@@ -0,0 +1,127 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// proxyRule degrades reverse proxied requests whose path starts with prefix.
+type proxyRule struct {
+	prefix   string
+	latency  time.Duration
+	errProb  float64
+	code     int
+	truncate float64
+}
+
+// proxyRules is a repeatable flag of rules like
+// /api:latency=500ms,error=10%,code=502,truncate=5%
+// The first rule whose prefix matches a request applies.
+type proxyRules []proxyRule
+
+func (p *proxyRules) String() string {
+	return fmt.Sprint(*p)
+}
+
+func (p *proxyRules) Set(s string) error {
+	prefix, opts, _ := strings.Cut(s, ":")
+	if !strings.HasPrefix(prefix, "/") {
+		return errors.New("rule must start with a path prefix")
+	}
+	pr := proxyRule{prefix: prefix, code: http.StatusServiceUnavailable}
+	for _, o := range strings.Split(opts, ",") {
+		if o == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(o, "=")
+		var err error
+		switch k {
+		case "latency":
+			pr.latency, err = time.ParseDuration(v)
+		case "error":
+			pr.errProb = percent(v)
+		case "code":
+			pr.code, err = strconv.Atoi(v)
+		case "truncate":
+			pr.truncate = percent(v)
+		default:
+			err = errors.New("unknown option " + k)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	*p = append(*p, pr)
+	return nil
+}
+
+func (p proxyRules) match(path string) (proxyRule, bool) {
+	for _, pr := range p {
+		if strings.HasPrefix(path, pr.prefix) {
+			return pr, true
+		}
+	}
+	return proxyRule{}, false
+}
+
+// reverseProxy forwards every request to target, injecting latency, errors
+// and truncated responses according to rules.
+func reverseProxy(target *url.URL, rules proxyRules) http.Handler {
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			pr, ok := rules.match(resp.Request.URL.Path)
+			if ok && pr.truncate > 0 && rng.Float64() < pr.truncate {
+				noteFault(resp.Request, "truncate")
+				resp.Body = &truncatedBody{ReadCloser: resp.Body, left: max(resp.ContentLength/2, 1)}
+			}
+			return nil
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pr, ok := rules.match(r.URL.Path)
+		if ok {
+			if pr.latency > 0 {
+				noteFault(r, "latency")
+			}
+			time.Sleep(pr.latency)
+			if pr.errProb > 0 && rng.Float64() < pr.errProb {
+				noteFault(r, "error")
+				http.Error(w, http.StatusText(pr.code), pr.code)
+				return
+			}
+		}
+		rp.ServeHTTP(w, r)
+	})
+}
+
+// truncatedBody fails after left bytes, which makes the ReverseProxy abort
+// the client connection mid response.
+type truncatedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		return 0, errors.New("truncated")
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
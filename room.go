@@ -0,0 +1,123 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// room is a broadcast group of websocket subscribers.
+type room struct {
+	name string
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+// subscriber receives the messages of a room, lag late.
+type subscriber struct {
+	msgs chan roomMessage
+	lag  time.Duration
+}
+
+type roomMessage struct {
+	mt   int
+	data []byte
+}
+
+var (
+	roomsMu sync.Mutex
+	rooms   = make(map[string]*room)
+)
+
+func joinRoom(name string, s *subscriber) *room {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	rm, ok := rooms[name]
+	if !ok {
+		rm = &room{name: name, subs: make(map[*subscriber]struct{})}
+		rooms[name] = rm
+	}
+	rm.mu.Lock()
+	rm.subs[s] = struct{}{}
+	rm.mu.Unlock()
+	return rm
+}
+
+func (rm *room) leave(s *subscriber) {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	rm.mu.Lock()
+	delete(rm.subs, s)
+	empty := len(rm.subs) == 0
+	rm.mu.Unlock()
+	if empty {
+		delete(rooms, rm.name)
+	}
+}
+
+// broadcast delivers m to every subscriber. Subscribers whose queue is full
+// miss the message rather than holding up the rest of the room.
+func (rm *room) broadcast(m roomMessage) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	for s := range rm.subs {
+		select {
+		case s.msgs <- m:
+		default:
+			slog.Debug("/ws-room dropped a message for a lagging subscriber", "room", rm.name)
+		}
+	}
+}
+
+// wsRoom joins the room called name, in which every message sent by any
+// client is delivered to all of them after delay. Each subscriber can add its
+// own lag before each message is written to it, and queue bounds how many
+// messages may wait for a lagging subscriber.
+func wsRoom(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	name := r.Form.Get("name")
+	delay := timeQueryParam(r.Form, "delay", 0)
+	s := &subscriber{
+		msgs: make(chan roomMessage, max(intQueryParam(r.Form, "queue", 100), 1)),
+		lag:  timeQueryParam(r.Form, "lag", 0),
+	}
+	c, err := upgrade(w, r)
+	if err != nil {
+		slog.Warn("room upgrade", "err", err)
+		return
+	}
+	defer c.Close()
+	rm := joinRoom(name, s)
+	defer rm.leave(s)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			mt, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			m := roomMessage{mt, data}
+			if delay > 0 {
+				time.AfterFunc(delay, func() { rm.broadcast(m) })
+			} else {
+				rm.broadcast(m)
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		case m := <-s.msgs:
+			time.Sleep(s.lag)
+			if err := c.WriteMessage(m.mt, m.data); err != nil {
+				slog.Debug("room write", "err", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,398 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// duration is a time.Duration written as a string such as "3s" in JSON.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	t, err := time.ParseDuration(s)
+	*d = duration(t)
+	return err
+}
+
+// rule applies a behavior to requests matching all of its regular
+// expressions. Empty expressions match anything.
+type rule struct {
+	Name      string            `json:"name,omitempty"`
+	Host      string            `json:"host,omitempty"`
+	Path      string            `json:"path,omitempty"`
+	Method    string            `json:"method,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Clients   string            `json:"clients,omitempty"`
+	Delay     duration          `json:"delay,omitempty"`
+	Abort     string            `json:"abort,omitempty"`
+	Status    int               `json:"status,omitempty"`
+	Reset     string            `json:"reset,omitempty"`
+	Bandwidth string            `json:"bandwidth,omitempty"`
+
+	host, path, method *regexp.Regexp
+	headers            map[string]*regexp.Regexp
+	clients            float64
+	abort, reset       float64
+	bandwidth          int64
+}
+
+// compile checks the rule and prepares it for matching.
+func (ru *rule) compile() error {
+	var err error
+	if ru.host, err = regexp.Compile(ru.Host); err != nil {
+		return err
+	}
+	if ru.path, err = regexp.Compile(ru.Path); err != nil {
+		return err
+	}
+	if ru.method, err = regexp.Compile(ru.Method); err != nil {
+		return err
+	}
+	ru.headers = make(map[string]*regexp.Regexp)
+	for k, v := range ru.Headers {
+		if ru.headers[k], err = regexp.Compile(v); err != nil {
+			return err
+		}
+	}
+	if ru.Clients != "" {
+		ru.clients = percent(ru.Clients)
+	}
+	if ru.Abort != "" {
+		ru.abort = percent(ru.Abort)
+	}
+	if ru.Reset != "" {
+		ru.reset = percent(ru.Reset)
+	}
+	if ru.Status == 0 {
+		ru.Status = http.StatusServiceUnavailable
+	}
+	if ru.Status < 100 || ru.Status > 999 {
+		return fmt.Errorf("status %d is not from 100 to 999", ru.Status)
+	}
+	if ru.Bandwidth != "" {
+		if ru.bandwidth, err = parseSize(ru.Bandwidth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ru *rule) match(r *http.Request) bool {
+	if !ru.host.MatchString(r.Host) || !ru.path.MatchString(r.URL.Path) || !ru.method.MatchString(r.Method) {
+		return false
+	}
+	for k, re := range ru.headers {
+		if !re.MatchString(r.Header.Get(k)) {
+			return false
+		}
+	}
+	return ru.clients == 0 || ru.bucket(r) < ru.clients
+}
+
+// bucketHeader names the request header identifying clients for sticky
+// bucketing. The client IP is used when it is empty or missing.
+var bucketHeader string
+
+// bucket hashes the client of r into [0, 1). The rule name salts the hash
+// so that different rules pick different clients.
+func (ru *rule) bucket(r *http.Request) float64 {
+	f := fnv.New32a()
+	f.Write([]byte(ru.Name))
+	f.Write([]byte(clientKey(r, bucketHeader)))
+	// FNV barely stirs the high bits for keys differing in the last byte,
+	// so finish with the murmur3 mixer.
+	h := f.Sum32()
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return float64(h) / (1 << 32)
+}
+
+// clientKey identifies the client of r by the header named key, falling
+// back to its IP address.
+func clientKey(r *http.Request, key string) string {
+	if k := r.Header.Get(key); key != "" && k != "" {
+		return k
+	}
+	k, _, _ := net.SplitHostPort(r.RemoteAddr)
+	return k
+}
+
+// rules holds the rules in use. The first matching rule applies.
+var rules atomic.Pointer[[]*rule]
+
+func init() {
+	rules.Store(&[]*rule{})
+}
+
+// parseRules reads a JSON array of rules.
+func parseRules(rd io.Reader) ([]*rule, error) {
+	var rs []*rule
+	if err := json.NewDecoder(rd).Decode(&rs); err != nil {
+		return nil, err
+	}
+	for i, ru := range rs {
+		if err := ru.compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return rs, nil
+}
+
+// rulesFile is the -rules file, reloaded on SIGHUP or through the admin API.
+var rulesFile string
+
+// reload loads the -rules and -scenarios files again. Only the rules,
+// schedule and scenarios change so established connections carry on
+// undisturbed. Mocks are mounted on the mux at startup and are not reloaded.
+func reload() error {
+	if rulesFile == "" && scenariosFile == "" {
+		return errors.New("no -rules or -scenarios file to reload")
+	}
+	if rulesFile != "" {
+		if err := loadRules(rulesFile); err != nil {
+			return fmt.Errorf("%s: %w", rulesFile, err)
+		}
+	}
+	if scenariosFile != "" {
+		if err := reloadScenarios(); err != nil {
+			return fmt.Errorf("%s: %w", scenariosFile, err)
+		}
+	}
+	return nil
+}
+
+// reloadOnHangup reloads the rules and scenarios files whenever SIGHUP
+// arrives.
+func reloadOnHangup() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		if err := reload(); err != nil {
+			slog.Error("reload", "err", err)
+		}
+	}
+}
+
+// adminReload reloads the rules and scenarios files on POST.
+func adminReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST to reload", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	io.WriteString(w, "reloaded "+strings.TrimSpace(rulesFile+" "+scenariosFile)+"\n")
+}
+
+// ruleConfig is the form of a -rules file with a schedule. A file may also
+// be just an array of rules.
+type ruleConfig struct {
+	Rules    []*rule   `json:"rules"`
+	Schedule *schedule `json:"schedule"`
+}
+
+// loadRules replaces the rules and schedule in use with those in file.
+func loadRules(file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var c ruleConfig
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		c.Rules, err = parseRules(bytes.NewReader(b))
+	} else if err = json.Unmarshal(b, &c); err == nil {
+		for i, ru := range c.Rules {
+			if err = ru.compile(); err != nil {
+				err = fmt.Errorf("rule %d: %w", i, err)
+				break
+			}
+		}
+		if err == nil && c.Schedule != nil {
+			err = c.Schedule.compile()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	rules.Store(&c.Rules)
+	startSchedule(c.Schedule)
+	slog.Info("loaded rules", "file", file, "n", len(c.Rules), "schedule", c.Schedule != nil)
+	return nil
+}
+
+func firstMatch(r *http.Request, rs []*rule) *rule {
+	for _, ru := range rs {
+		if ru.match(r) {
+			return ru
+		}
+	}
+	return nil
+}
+
+// ruleEngine wraps h to apply the first rule matching each request, trying
+// the profile of the listener, host profiles, the current schedule phase and
+// then the rules.
+func ruleEngine(h http.Handler, hosts []*rule) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ru, _ := r.Context().Value(listenerRuleKey{}).(*rule)
+		if ru == nil {
+			ru = firstMatch(r, hosts)
+		}
+		if ru == nil {
+			ru = firstMatch(r, *phaseRules.Load())
+		}
+		if ru == nil {
+			ru = firstMatch(r, *rules.Load())
+		}
+		if ru == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		noteFault(r, "rule:"+ru.Name)
+		time.Sleep(time.Duration(ru.Delay))
+		if ru.reset > 0 && rng.Float64() < ru.reset {
+			resetConn(w)
+			return
+		}
+		if ru.abort > 0 && rng.Float64() < ru.abort {
+			http.Error(w, http.StatusText(ru.Status), ru.Status)
+			return
+		}
+		if ru.bandwidth > 0 {
+			w = &impairedWriter{ResponseWriter: w, s: &shaper{im: impairment{Bandwidth: ru.bandwidth}}}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// adminRules shows the rules on GET, replaces them with a JSON array on
+// PUT or POST and removes them all on DELETE.
+func adminRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		rs, err := parseRules(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rules.Store(&rs)
+		slog.Info("rules replaced", "n", len(rs))
+	case http.MethodDelete:
+		rules.Store(&[]*rule{})
+		slog.Info("rules removed")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(*rules.Load())
+}
+
+// resetConn hijacks the connection of w and closes it with a TCP RST.
+func resetConn(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	c, _, err := hj.Hijack()
+	if err != nil {
+		slog.Warn("reset hijack", "err", err)
+		return
+	}
+	for nc := net.Conn(c); nc != nil; {
+		if tc, ok := nc.(*net.TCPConn); ok {
+			tc.SetLinger(0)
+			break
+		}
+		u, ok := nc.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		nc = u.NetConn()
+	}
+	c.Close()
+}
+
+// hostProfiles is a repeatable flag of rules for a Host such as
+// slow.test:delay=2s or flaky.test:reset=10%. The options are delay, abort,
+// status, reset, bandwidth and clients.
+type hostProfiles []*rule
+
+func (p *hostProfiles) String() string {
+	return fmt.Sprint(*p)
+}
+
+func (p *hostProfiles) Set(s string) error {
+	host, opts, _ := strings.Cut(s, ":")
+	ru := &rule{Name: host, Host: "^(?i)" + regexp.QuoteMeta(host) + `(:\d+)?$`}
+	if err := ru.parseOptions(opts); err != nil {
+		return err
+	}
+	*p = append(*p, ru)
+	return nil
+}
+
+// parseOptions sets the behavior of ru from a comma separated list of
+// options: delay, abort, status, reset, clients and bandwidth.
+func (ru *rule) parseOptions(opts string) error {
+	for _, o := range strings.Split(opts, ",") {
+		if o == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(o, "=")
+		switch k {
+		case "delay":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			ru.Delay = duration(d)
+		case "abort":
+			ru.Abort = v
+		case "status":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+			ru.Status = n
+		case "reset":
+			ru.Reset = v
+		case "clients":
+			ru.Clients = v
+		case "bandwidth":
+			ru.Bandwidth = v
+		default:
+			return errors.New("unknown option " + k)
+		}
+	}
+	return ru.compile()
+}
@@ -3,4 +3,4 @@
 set -euo pipefail
 IFS=$'\n\t'
 
-exec /app -httpPort $NOMAD_PORT_http
+exec /app -pidfile /run/app.pid -httpPort $NOMAD_PORT_http
@@ -0,0 +1,160 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// scenarioStep is one step of a websocket scenario. Op says what it does:
+//
+//	echo    - echo Count messages from the client
+//	send    - send Text Count times, Every apart
+//	ping    - send Count pings, Every apart
+//	stall   - do nothing for For
+//	close   - send a close frame with Code and Text and end the scenario
+//	drop    - close the TCP connection without a close frame, which the
+//	          client sees as 1006, and end the scenario
+//	violate - commit the /ws-violate violation named by Text
+type scenarioStep struct {
+	Op    string   `json:"op"`
+	Count int      `json:"count,omitempty"`
+	Text  string   `json:"text,omitempty"`
+	Every duration `json:"every,omitempty"`
+	For   duration `json:"for,omitempty"`
+	Code  int      `json:"code,omitempty"`
+}
+
+// scenariosFile is the -scenarios file, reloaded along with the rules.
+var scenariosFile string
+
+// scenarios are the scripts of the -scenarios file, by name, replaced whole
+// when it is reloaded.
+var scenarios atomic.Pointer[map[string][]scenarioStep]
+
+// reloadScenarios loads scenariosFile again. Connections already playing a
+// scenario finish the one they started.
+func reloadScenarios() error {
+	ss, err := loadScenarios(scenariosFile)
+	if err != nil {
+		return err
+	}
+	scenarios.Store(&ss)
+	return nil
+}
+
+// loadScenarios reads a JSON object of named lists of steps from file.
+func loadScenarios(file string) (map[string][]scenarioStep, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var ss map[string][]scenarioStep
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return nil, err
+	}
+	for name, steps := range ss {
+		for i, st := range steps {
+			switch st.Op {
+			case "echo", "send", "ping", "stall", "close", "drop":
+			case "violate":
+				if violations[st.Text] == nil {
+					return nil, fmt.Errorf("scenario %s step %d: unknown violation %q", name, i, st.Text)
+				}
+			default:
+				return nil, fmt.Errorf("scenario %s step %d: unknown op %q", name, i, st.Op)
+			}
+		}
+	}
+	return ss, nil
+}
+
+// wsScenario plays the scenario called name on a websocket connection and
+// then closes it normally, unless a step already ended it.
+func wsScenario(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	var steps []scenarioStep
+	ok := false
+	if ss := scenarios.Load(); ss != nil {
+		steps, ok = (*ss)[name]
+	}
+	if !ok {
+		http.Error(w, "no scenario called "+name, http.StatusNotFound)
+		return
+	}
+	c, err := upgrade(w, r)
+	if err != nil {
+		slog.Warn("scenario upgrade", "err", err)
+		return
+	}
+	defer c.Close()
+	noteFault(r, "scenario:"+name)
+	for i, st := range steps {
+		slog.Debug("scenario step", "name", name, "step", i, "op", st.Op)
+		done, err := playStep(c, st)
+		if err != nil {
+			slog.Debug("scenario", "name", name, "step", i, "err", err)
+			return
+		}
+		if done {
+			return
+		}
+	}
+	c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "scenario over"))
+	time.Sleep(time.Second)
+}
+
+// playStep plays st on c, reporting whether the connection is finished.
+func playStep(c *websocket.Conn, st scenarioStep) (bool, error) {
+	switch st.Op {
+	case "echo":
+		for i := 0; i < st.Count; i++ {
+			mt, msg, err := c.ReadMessage()
+			if err != nil {
+				return true, err
+			}
+			if err := c.WriteMessage(mt, msg); err != nil {
+				return true, err
+			}
+		}
+	case "send", "ping":
+		for i := 0; i < st.Count; i++ {
+			if i > 0 {
+				time.Sleep(time.Duration(st.Every))
+			}
+			var err error
+			if st.Op == "send" {
+				err = c.WriteMessage(websocket.TextMessage, []byte(st.Text))
+			} else {
+				err = c.WriteControl(websocket.PingMessage, []byte(st.Text), time.Now().Add(10*time.Second))
+			}
+			if err != nil {
+				return true, err
+			}
+		}
+	case "stall":
+		time.Sleep(time.Duration(st.For))
+	case "close":
+		payload := binary.BigEndian.AppendUint16(nil, uint16(st.Code))
+		payload = append(payload, st.Text...)
+		if err := writeFrame(c.UnderlyingConn(), true, opClose, payload); err != nil {
+			return true, err
+		}
+		time.Sleep(time.Second)
+		return true, nil
+	case "drop":
+		return true, nil
+	case "violate":
+		return false, violations[st.Text](c.UnderlyingConn())
+	}
+	return false, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// schedule is a sequence of phases, each applying its rules for a while
+// before the next takes over. After the last phase requests are back to
+// normal. A schedule with a start time of day runs every day at that time,
+// one without runs once as soon as it is loaded.
+type schedule struct {
+	Start  string   `json:"start,omitempty"`
+	Phases []*phase `json:"phases"`
+}
+
+type phase struct {
+	Name  string   `json:"name,omitempty"`
+	For   duration `json:"for"`
+	Rules []*rule  `json:"rules,omitempty"`
+}
+
+func (s *schedule) compile() error {
+	if s.Start != "" {
+		if _, err := time.Parse("15:04", s.Start); err != nil {
+			return fmt.Errorf("schedule start: %w", err)
+		}
+	}
+	for i, p := range s.Phases {
+		for j, ru := range p.Rules {
+			if err := ru.compile(); err != nil {
+				return fmt.Errorf("phase %d rule %d: %w", i, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// nextStart is the next time after now that the schedule starts.
+func (s *schedule) nextStart(now time.Time) time.Time {
+	t, _ := time.Parse("15:04", s.Start)
+	start := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if start.Before(now) {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start
+}
+
+// phaseRules holds the rules of the current phase of the schedule.
+var phaseRules atomic.Pointer[[]*rule]
+
+func init() {
+	phaseRules.Store(&[]*rule{})
+}
+
+var scheduleMu sync.Mutex
+var stopSchedule = func() {}
+
+// startSchedule replaces the running schedule with s, which may be nil.
+func startSchedule(s *schedule) {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	stopSchedule()
+	phaseRules.Store(&[]*rule{})
+	if s == nil || len(s.Phases) == 0 {
+		stopSchedule = func() {}
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopSchedule = cancel
+	go s.run(ctx)
+}
+
+func (s *schedule) run(ctx context.Context) {
+	for {
+		if s.Start != "" {
+			start := s.nextStart(time.Now())
+			slog.Info("schedule waiting", "start", start)
+			if sleep(ctx, time.Until(start)) != nil {
+				return
+			}
+		}
+		for i, p := range s.Phases {
+			if ctx.Err() != nil {
+				return
+			}
+			phaseRules.Store(&p.Rules)
+			slog.Info("schedule phase", "phase", i, "name", p.Name, "for", time.Duration(p.For))
+			if sleep(ctx, time.Duration(p.For)) != nil {
+				return
+			}
+		}
+		phaseRules.Store(&[]*rule{})
+		slog.Info("schedule done")
+		if s.Start == "" {
+			return
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// rng is the source of all randomness in injected faults so that a chaos
+// run can be repeated with -seed.
+var rng = &lockedRand{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// lockedRand is a rand.Rand safe for use by concurrent requests.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (l *lockedRand) seed(s int64) {
+	l.mu.Lock()
+	l.r.Seed(s)
+	l.mu.Unlock()
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+func (l *lockedRand) Int63n(n int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Int63n(n)
+}
@@ -0,0 +1,42 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// slowHeaders hijacks the connection and writes the status line and then
+// each header after delay, with count extra headers to stretch it out. The
+// short body follows the end of the headers at once.
+func slowHeaders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	delay := timeQueryParam(q, "delay", 500*time.Millisecond)
+	count := intQueryParam(q, "count", 10)
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		slog.Warn("slowheaders hijack", "err", err)
+		return
+	}
+	defer conn.Close()
+	noteFault(r, "slowHeaders")
+	body := "headers finally done\n"
+	lines := []string{"HTTP/1.1 200 OK\r\n", "Content-Type: text/plain\r\n", fmt.Sprintf("Content-Length: %d\r\n", len(body))}
+	for i := 0; i < count; i++ {
+		lines = append(lines, fmt.Sprintf("X-Slow-Header-%d: %s\r\n", i, time.Duration(i+1)*delay))
+	}
+	lines = append(lines, "Connection: close\r\n", "\r\n"+body)
+	for i, l := range lines {
+		if i > 0 && i < len(lines)-1 {
+			time.Sleep(delay)
+		}
+		brw.WriteString(l)
+		if err := brw.Flush(); err != nil {
+			slog.Debug("slowheaders write", "err", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// endpointStats are the counters kept for each endpoint.
+type endpointStats struct {
+	Requests   atomic.Int64
+	Active     atomic.Int64
+	Bytes      atomic.Int64
+	Faults     atomic.Int64
+	Websockets atomic.Int64
+	mu         sync.Mutex
+	statuses   map[string]int64
+}
+
+func (es *endpointStats) MarshalJSON() ([]byte, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return json.Marshal(map[string]any{
+		"requests":       es.Requests.Load(),
+		"active":         es.Active.Load(),
+		"bytes":          es.Bytes.Load(),
+		"faults":         es.Faults.Load(),
+		"websocketsOpen": es.Websockets.Load(),
+		"statuses":       es.statuses,
+	})
+}
+
+// serverStats is what /admin/stats reports.
+var serverStats = struct {
+	started   time.Time
+	mu        sync.Mutex
+	endpoints map[string]*endpointStats
+	connsOpen atomic.Int64
+	conns     atomic.Int64
+	hijacked  atomic.Int64
+}{started: time.Now(), endpoints: make(map[string]*endpointStats)}
+
+func statsFor(endpoint string) *endpointStats {
+	serverStats.mu.Lock()
+	defer serverStats.mu.Unlock()
+	es := serverStats.endpoints[endpoint]
+	if es == nil {
+		es = &endpointStats{statuses: make(map[string]int64)}
+		serverStats.endpoints[endpoint] = es
+	}
+	return es
+}
+
+// endpointName names the endpoint r is routed to by mux, which is nil when
+// every request is reverse proxied.
+func endpointName(mux *http.ServeMux, r *http.Request) string {
+	switch {
+	case r.Method == http.MethodConnect:
+		return "CONNECT"
+	case mux == nil:
+		return "proxy"
+	}
+	if _, pattern := mux.Handler(r); pattern != "" {
+		return pattern
+	}
+	return "unmatched"
+}
+
+// begin counts the start of a request and returns a func to count its end.
+func (es *endpointStats) begin(r *http.Request) func(status int, bytes int64, faults int) {
+	es.Requests.Add(1)
+	es.Active.Add(1)
+	ws := strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+	if ws {
+		es.Websockets.Add(1)
+	}
+	return func(status int, bytes int64, faults int) {
+		es.Active.Add(-1)
+		if ws {
+			es.Websockets.Add(-1)
+		}
+		es.Bytes.Add(bytes)
+		es.Faults.Add(int64(faults))
+		s := "hijacked"
+		if status != 0 {
+			s = strconv.Itoa(status)
+		}
+		es.mu.Lock()
+		es.statuses[s]++
+		es.mu.Unlock()
+	}
+}
+
+// trackConnState is the http.Server ConnState hook counting connections.
+func trackConnState(c net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		serverStats.conns.Add(1)
+		serverStats.connsOpen.Add(1)
+	case http.StateHijacked:
+		serverStats.hijacked.Add(1)
+		serverStats.connsOpen.Add(-1)
+	case http.StateClosed:
+		serverStats.connsOpen.Add(-1)
+	}
+}
+
+// adminStats reports serverStats as JSON.
+func adminStats(w http.ResponseWriter, r *http.Request) {
+	serverStats.mu.Lock()
+	endpoints := make(map[string]*endpointStats, len(serverStats.endpoints))
+	for k, v := range serverStats.endpoints {
+		endpoints[k] = v
+	}
+	serverStats.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(map[string]any{
+		"uptime": time.Since(serverStats.started).String(),
+		"connections": map[string]int64{
+			"open":     serverStats.connsOpen.Load(),
+			"total":    serverStats.conns.Load(),
+			"hijacked": serverStats.hijacked.Load(),
+		},
+		"endpoints": endpoints,
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// tarpitBanners are the greetings of the protocols the tarpit impersonates,
+// and the continuation line it answers every command with. SMTP and FTP
+// continuation lines promise more to come, so clients keep waiting.
+var tarpitBanners = map[string]struct{ banner, pending string }{
+	"smtp": {"220-slowserver ESMTP tarpit\r\n220-please wait\r\n", "250-still working\r\n"},
+	"ftp":  {"220-slowserver FTP tarpit\r\n220-please wait\r\n", "150-still working\r\n"},
+	"pop3": {"+OK slowserver POP3 tarpit ready\r\n", ""},
+}
+
+// serveTarpit accepts connections on addr and speaks the banner of proto at
+// rate bytes per second. Commands are never completed.
+func serveTarpit(addr, proto string, rate int) {
+	b, ok := tarpitBanners[proto]
+	if !ok {
+		fatal("unknown tarpit protocol", "proto", proto)
+	}
+	l, err := listen("tarpit", addr)
+	if err != nil {
+		fatal("tarpit listen", "err", err)
+	}
+	l = pausable(l)
+	slog.Info("tarpit listening", "addr", l.Addr(), "proto", proto)
+	delay := time.Second / time.Duration(max(rate, 1))
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			slog.Warn("tarpit accept", "err", err)
+			continue
+		}
+		go tarpit(c, b.banner, b.pending, delay)
+	}
+}
+
+func tarpit(c net.Conn, banner, pending string, delay time.Duration) {
+	defer c.Close()
+	trickle := func(s string) bool {
+		for i := 0; i < len(s); i++ {
+			if _, err := c.Write([]byte{s[i]}); err != nil {
+				return false
+			}
+			time.Sleep(delay)
+		}
+		return true
+	}
+	if !trickle(banner) {
+		return
+	}
+	// Wait for a command and answer it forever, or never if there is no
+	// continuation in this protocol.
+	s := bufio.NewScanner(c)
+	if !s.Scan() {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		for s.Scan() {
+		}
+		close(done)
+	}()
+	if pending == "" {
+		<-done
+		return
+	}
+	for trickle(pending) {
+	}
+}
+
+// httpTarpit answers with a body written and flushed one byte at a time,
+// byteDelay apart, for duration or, if duration is 0, until the client goes
+// away.
+func httpTarpit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	byteDelay := timeQueryParam(q, "byteDelay", time.Second)
+	duration := timeQueryParam(q, "duration", 0)
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "tarpit needs a flushable response", http.StatusInternalServerError)
+		return
+	}
+	noteFault(r, "tarpit")
+	w.Header().Set("Content-Type", "text/plain")
+	var done <-chan time.Time
+	if duration > 0 {
+		done = time.After(duration)
+	}
+	t := time.NewTicker(max(byteDelay, time.Millisecond))
+	defer t.Stop()
+	for i := 0; ; i++ {
+		if _, err := w.Write([]byte{"tarpit\n"[i%7]}); err != nil {
+			return
+		}
+		f.Flush()
+		select {
+		case <-t.C:
+		case <-done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
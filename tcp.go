@@ -0,0 +1,81 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// tcpBehavior configures how the raw TCP listener misbehaves.
+type tcpBehavior struct {
+	mode  string        // echo, drip, blackhole, close or rst
+	delay time.Duration // echo latency or time between drips
+	bytes int           // bytes per drip or bytes read before close
+	after time.Duration // time before rst
+}
+
+// serveTCP accepts raw TCP connections on addr and misbehaves on each of
+// them as b says.
+func serveTCP(addr string, b tcpBehavior) {
+	l, err := listen("tcp", addr)
+	if err != nil {
+		fatal("tcp listen", "err", err)
+	}
+	l = pausable(l)
+	slog.Info("tcp listening", "addr", l.Addr(), "mode", b.mode)
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			slog.Warn("tcp accept", "err", err)
+			continue
+		}
+		go b.serve(c)
+	}
+}
+
+func (b tcpBehavior) serve(c net.Conn) {
+	defer c.Close()
+	switch b.mode {
+	case "echo":
+		// Echo lines back, each after delay.
+		s := bufio.NewScanner(c)
+		for s.Scan() {
+			time.Sleep(b.delay)
+			if _, err := c.Write(append(s.Bytes(), '\n')); err != nil {
+				return
+			}
+		}
+	case "drip":
+		// Write bytes at a time every delay, forever.
+		go io.Copy(io.Discard, c)
+		buf := make([]byte, max(b.bytes, 1))
+		for i := range buf {
+			buf[i] = 'd'
+		}
+		for {
+			if _, err := c.Write(buf); err != nil {
+				return
+			}
+			time.Sleep(b.delay)
+		}
+	case "blackhole":
+		// Read everything and never respond.
+		io.Copy(io.Discard, c)
+	case "close":
+		// Close after reading bytes.
+		io.CopyN(io.Discard, c, int64(b.bytes))
+	case "rst":
+		// Reset the connection after a while instead of closing it.
+		go io.Copy(io.Discard, c)
+		time.Sleep(b.after)
+		if tc, ok := c.(*net.TCPConn); ok {
+			tc.SetLinger(0)
+		}
+	default:
+		slog.Warn("unknown tcp mode", "mode", b.mode)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// tlsTiny hijacks an HTTP/1.1 https connection and writes the whole
+// response, headers included, one byte per write. crypto/tls sends each
+// write as its own record, so the response arrives in size 1-byte TLS
+// records, byteDelay apart, stalling clients at the TLS layer rather than in
+// HTTP.
+//
+// TODO: stall mid-response on a renegotiation (TLS 1.2 HelloRequest) or a
+// post-handshake client auth request (TLS 1.3 CertificateRequest).
+// crypto/tls servers can send neither, so these need their own record layer
+// over the hijacked connection.
+func tlsTiny(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if r.TLS == nil {
+		http.Error(w, "tiny records need https", http.StatusBadRequest)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tiny records need HTTP/1.1", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	size := max(sizeQueryParam(q, "size", 1<<10), 0)
+	byteDelay := timeQueryParam(q, "byteDelay", 10*time.Millisecond)
+	c, _, err := hj.Hijack()
+	if err != nil {
+		slog.Warn("tls tiny hijack", "err", err)
+		return
+	}
+	defer c.Close()
+	noteFault(r, "tlsTiny")
+	header := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: %d\r\nConnection: close\r\n\r\n", size)
+	// The body is written as it goes rather than built, as size may be huge.
+	for i := int64(0); i < int64(len(header))+size; i++ {
+		b := byte('t')
+		if i < int64(len(header)) {
+			b = header[i]
+		}
+		if _, err := c.Write([]byte{b}); err != nil {
+			slog.Debug("tls tiny write", "err", err)
+			return
+		}
+		time.Sleep(byteDelay)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// udpBehavior configures how the UDP echo listener impairs datagrams.
+type udpBehavior struct {
+	delay   time.Duration
+	drop    float64 // probability a datagram is not echoed
+	dup     float64 // probability a datagram is echoed twice
+	reorder float64 // probability a datagram is held back behind later ones
+	holdFor time.Duration
+}
+
+// serveUDP echoes datagrams received on addr, impaired as b says.
+func serveUDP(addr string, b udpBehavior) {
+	c, err := listenPacket(addr)
+	if err != nil {
+		fatal("udp listen", "err", err)
+	}
+	slog.Info("udp listening", "addr", c.LocalAddr())
+	buf := make([]byte, 64<<10)
+	for {
+		n, from, err := c.ReadFrom(buf)
+		if err != nil {
+			slog.Debug("udp read", "err", err)
+			continue
+		}
+		if rng.Float64() < b.drop {
+			continue
+		}
+		p := append([]byte(nil), buf[:n]...)
+		d := b.delay
+		if rng.Float64() < b.reorder {
+			d += b.holdFor
+		}
+		copies := 1
+		if rng.Float64() < b.dup {
+			copies = 2
+		}
+		time.AfterFunc(d, func() {
+			for i := 0; i < copies; i++ {
+				if _, err := c.WriteTo(p, from); err != nil {
+					slog.Debug("udp write", "err", err)
+				}
+			}
+		})
+	}
+}
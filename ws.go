@@ -0,0 +1,437 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// discardReads reads and discards messages from c so that control frames are
+// processed. The returned channel is closed when reading fails.
+func discardReads(c *websocket.Conn) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := c.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// firehose pushes size byte messages at rate messages per second, burst at a
+// time, whether or not the client keeps up. Writes have no deadline so a slow
+// reader pushes back on the server.
+func firehose(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	rate := max(intQueryParam(r.Form, "rate", 1000), 1)
+	size := max(sizeQueryParam(r.Form, "size", 1024), 0)
+	burst := max(intQueryParam(r.Form, "burst", 1), 1)
+	c, err := upgrade(w, r)
+	if err != nil {
+		slog.Warn("firehose upgrade", "err", err)
+		return
+	}
+	defer c.Close()
+	done := discardReads(c)
+	t := time.NewTicker(max(time.Second*time.Duration(burst)/time.Duration(rate), time.Nanosecond))
+	defer t.Stop()
+	start := time.Now()
+	sent := 0
+	defer func() {
+		slog.Info("/ws-firehose done", "sent", sent, "duration", time.Since(start))
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		for i := 0; i < burst; i++ {
+			// Messages are streamed rather than built, as size may be huge.
+			mw, err := c.NextWriter(websocket.BinaryMessage)
+			if err == nil {
+				_, err = io.CopyN(mw, repeatReader('f'), size)
+				if cerr := mw.Close(); err == nil {
+					err = cerr
+				}
+			}
+			if err != nil {
+				slog.Debug("firehose write", "err", err)
+				return
+			}
+			sent++
+		}
+	}
+}
+
+// zombie completes the handshake and then never reads, so the client's send
+// buffers fill up. With a positive send it writes a message every send interval,
+// otherwise it never writes either. The connection is dropped after duration.
+func zombie(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	send := timeQueryParam(r.Form, "send", 0)
+	duration := timeQueryParam(r.Form, "duration", time.Hour)
+	c, err := upgrade(w, r)
+	if err != nil {
+		slog.Warn("zombie upgrade", "err", err)
+		return
+	}
+	defer c.Close()
+	end := time.After(duration)
+	if send <= 0 {
+		<-end
+		return
+	}
+	t := time.NewTicker(send)
+	defer t.Stop()
+	for {
+		select {
+		case <-end:
+			return
+		case <-t.C:
+		}
+		if err := c.WriteMessage(websocket.TextMessage, []byte("braaains\n")); err != nil {
+			slog.Debug("zombie write", "err", err)
+			return
+		}
+	}
+}
+
+// closer closes the connection after a delay with an arbitrary close code,
+// including reserved and invalid ones, and message as the close reason. With
+// tcp=true the TCP connection is closed without sending a close frame.
+func closer(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	code := intQueryParam(r.Form, "code", websocket.CloseNormalClosure)
+	after := timeQueryParam(r.Form, "after", 0)
+	message := r.Form.Get("message")
+	tcp := r.Form.Get("tcp") == "true"
+	c, err := upgrade(w, r)
+	if err != nil {
+		slog.Warn("close upgrade", "err", err)
+		return
+	}
+	defer c.Close()
+	select {
+	case <-discardReads(c):
+		return
+	case <-time.After(after):
+	}
+	if tcp {
+		return
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, message...)
+	if err := writeFrame(c.UnderlyingConn(), true, opClose, payload); err != nil {
+		slog.Debug("close write", "err", err)
+		return
+	}
+	// Give the client a moment to answer with its own close frame.
+	time.Sleep(time.Second)
+}
+
+// violations are the protocol violations /ws-violate can commit, each written
+// directly to the connection.
+var violations = map[string]func(w io.Writer) error{
+	// rsv sets all three RSV bits without an extension negotiating them.
+	"rsv": func(w io.Writer) error {
+		return writeRawFrame(w, 0x80|0x70|opText, nil, []byte("rsv bits set"))
+	},
+	// opcode uses the reserved non-control opcode 0x3.
+	"opcode": func(w io.Writer) error {
+		return writeRawFrame(w, 0x80|0x3, nil, []byte("unknown opcode"))
+	},
+	// masked sends a masked frame, which only clients may do.
+	"masked": func(w io.Writer) error {
+		return writeRawFrame(w, 0x80|opText, []byte{1, 2, 3, 4}, []byte("masked by server"))
+	},
+	// interleave injects control frames between the fragments of a message.
+	"interleave": func(w io.Writer) error {
+		if err := writeFrame(w, false, opText, []byte("inter")); err != nil {
+			return err
+		}
+		if err := writeFrame(w, true, opPing, []byte("ping")); err != nil {
+			return err
+		}
+		if err := writeFrame(w, true, opPong, []byte("pong")); err != nil {
+			return err
+		}
+		return writeFrame(w, true, opContinuation, []byte("leaved"))
+	},
+	// nested starts a new data message before the fragmented one finished.
+	"nested": func(w io.Writer) error {
+		if err := writeFrame(w, false, opText, []byte("outer")); err != nil {
+			return err
+		}
+		if err := writeFrame(w, true, opText, []byte("inner")); err != nil {
+			return err
+		}
+		return writeFrame(w, true, opContinuation, []byte("outer end"))
+	},
+	// fragctl fragments a ping, control frames must not be fragmented.
+	"fragctl": func(w io.Writer) error {
+		if err := writeFrame(w, false, opPing, []byte("frag")); err != nil {
+			return err
+		}
+		return writeFrame(w, true, opContinuation, []byte("mented"))
+	},
+	// bigctl sends a ping larger than the 125 byte control frame limit.
+	"bigctl": func(w io.Writer) error {
+		return writeFrame(w, true, opPing, bytes.Repeat([]byte("p"), 200))
+	},
+	// utf8 sends a text frame which is not valid UTF-8.
+	"utf8": func(w io.Writer) error {
+		return writeFrame(w, true, opText, []byte{'b', 'a', 'd', 0xff, 0xfe, 0xc3, 0x28})
+	},
+}
+
+// violate commits the protocol violation named by mode after a delay and then
+// waits for the client to react.
+func violate(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	mode := r.Form.Get("mode")
+	after := timeQueryParam(r.Form, "after", 0)
+	wait := timeQueryParam(r.Form, "wait", 10*time.Second)
+	v, ok := violations[mode]
+	if !ok {
+		modes := make([]string, 0, len(violations))
+		for m := range violations {
+			modes = append(modes, m)
+		}
+		slices.Sort(modes)
+		http.Error(w, "mode must be one of: "+strings.Join(modes, ", "), http.StatusBadRequest)
+		return
+	}
+	c, err := upgrade(w, r)
+	if err != nil {
+		slog.Warn("violate upgrade", "err", err)
+		return
+	}
+	defer c.Close()
+	time.Sleep(after)
+	if err := v(c.UnderlyingConn()); err != nil {
+		slog.Debug("violate write", "err", err)
+		return
+	}
+	select {
+	case <-discardReads(c):
+	case <-time.After(wait):
+	}
+}
+
+// bigFrame sends a single binary frame of frame bytes. With stall set it only
+// writes the frame header and stalls for that long instead of sending the
+// payload.
+func bigFrame(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	size := sizeQueryParam(r.Form, "frame", 64<<20)
+	stall := timeQueryParam(r.Form, "stall", 0)
+	c, err := upgrade(w, r)
+	if err != nil {
+		slog.Warn("big upgrade", "err", err)
+		return
+	}
+	defer c.Close()
+	done := discardReads(c)
+	conn := c.UnderlyingConn()
+	if _, err := conn.Write(frameHeader(0x80|opBinary, false, uint64(size))); err != nil {
+		slog.Debug("big write", "err", err)
+		return
+	}
+	if stall > 0 {
+		select {
+		case <-done:
+		case <-time.After(stall):
+		}
+		return
+	}
+	start := time.Now()
+	n, err := io.CopyN(conn, repeatReader('b'), size)
+	slog.Info("/ws-big done", "wrote", n, "size", size, "duration", time.Since(start))
+	if err != nil {
+		slog.Debug("big write", "err", err)
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+	}
+}
+
+// repeatReader is an endless stream of one byte.
+type repeatReader byte
+
+func (b repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(b)
+	}
+	return len(p), nil
+}
+
+// slowShake delays the 101 Switching Protocols response. With trickle=true the
+// handshake response is written a byte at a time, byteDelay apart.
+func slowShake(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	delay := timeQueryParam(r.Form, "delay", 30*time.Second)
+	trickle := r.Form.Get("trickle") == "true"
+	byteDelay := timeQueryParam(r.Form, "byteDelay", 100*time.Millisecond)
+	time.Sleep(delay)
+	if !trickle {
+		c, err := upgrade(w, r)
+		if err != nil {
+			slog.Warn("slowshake upgrade", "err", err)
+			return
+		}
+		defer c.Close()
+		c.WriteMessage(websocket.TextMessage, []byte("handshake complete"))
+		<-discardReads(c)
+		return
+	}
+	key := r.Header.Get("Sec-Websocket-Key")
+	if !websocket.IsWebSocketUpgrade(r) || key == "" {
+		http.Error(w, "not a websocket handshake", http.StatusBadRequest)
+		return
+	}
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		slog.Warn("slowshake hijack", "err", err)
+		return
+	}
+	defer conn.Close()
+	resp := switchingProtocols(key, "")
+	for i := 0; i < len(resp); i++ {
+		if _, err := conn.Write([]byte{resp[i]}); err != nil {
+			slog.Debug("slowshake write", "err", err)
+			return
+		}
+		time.Sleep(byteDelay)
+	}
+	if err := writeFrame(conn, true, opText, []byte("handshake complete")); err != nil {
+		slog.Debug("slowshake write", "err", err)
+		return
+	}
+	// Without gorilla on this connection just wait for the client to go away.
+	conn.SetReadDeadline(time.Now().Add(time.Minute))
+	io.Copy(io.Discard, brw)
+}
+
+// switchingProtocols returns a 101 response to a handshake with key, with
+// extra (CRLF terminated header lines) included verbatim.
+func switchingProtocols(key, extra string) string {
+	return "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n" +
+		extra + "\r\n"
+}
+
+// acceptKey computes Sec-WebSocket-Accept for a Sec-WebSocket-Key.
+func acceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+"258EAFA5-E914-47DA-95CA-C5AB0DC85B11")
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// reject refuses the websocket upgrade with status code after delay. Each
+// header query param, formatted as "Name: value", is added to the response.
+func reject(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	code := intQueryParam(r.Form, "code", http.StatusForbidden)
+	if code < 100 || code > 999 {
+		http.Error(w, "code must be a status code from 100 to 999", http.StatusBadRequest)
+		return
+	}
+	delay := timeQueryParam(r.Form, "delay", 0)
+	body := r.Form.Get("body")
+	for _, h := range r.Form["header"] {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok {
+			slog.Warn("couldn't parse header query parameter", "header", h)
+			continue
+		}
+		w.Header().Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	if body == "" {
+		body = http.StatusText(code)
+	}
+	time.Sleep(delay)
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/plain")
+	}
+	w.WriteHeader(code)
+	io.WriteString(w, body)
+}
+
+// subproto negotiates the subprotocol badly according to mode: echo selects
+// the first one offered, unoffered selects proto which was not offered, empty
+// sends an empty Sec-WebSocket-Protocol header and omit leaves it out even
+// though the client offered some. The connection then echoes messages.
+func subproto(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	mode := r.Form.Get("mode")
+	proto := r.Form.Get("proto")
+	if proto == "" {
+		proto = "bogus.slowserver"
+	}
+	offered := websocket.Subprotocols(r)
+	switch mode {
+	case "", "echo":
+		if len(offered) > 0 {
+			w.Header().Set("Sec-Websocket-Protocol", offered[0])
+		}
+	case "unoffered":
+		w.Header().Set("Sec-Websocket-Protocol", proto)
+	case "omit":
+	case "empty":
+		// gorilla/websocket leaves out an empty header, so handshake by hand.
+		key := r.Header.Get("Sec-Websocket-Key")
+		if !websocket.IsWebSocketUpgrade(r) || key == "" {
+			http.Error(w, "not a websocket handshake", http.StatusBadRequest)
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			slog.Warn("subproto hijack", "err", err)
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, switchingProtocols(key, "Sec-WebSocket-Protocol: \r\n"))
+		writeFrame(conn, true, opText, []byte("subprotocol: \n"))
+		conn.SetReadDeadline(time.Now().Add(time.Minute))
+		io.Copy(io.Discard, brw)
+		return
+	default:
+		http.Error(w, "mode must be one of: echo, unoffered, empty, omit", http.StatusBadRequest)
+		return
+	}
+	c, err := upgrade(w, r)
+	if err != nil {
+		slog.Warn("subproto upgrade", "err", err)
+		return
+	}
+	defer c.Close()
+	c.WriteMessage(websocket.TextMessage, []byte("subprotocol: "+c.Subprotocol()+"\n"))
+	for {
+		mt, message, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := c.WriteMessage(mt, message); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 Cisco Inc. All Rights Reserved.
+
+package main
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Websocket opcodes as defined in RFC 6455 section 5.2.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// writeFrame writes a single unmasked websocket frame directly to w. It is
+// used when gorilla/websocket will not produce the framing we want, so the
+// caller must make sure nothing else is writing to the connection.
+func writeFrame(w io.Writer, fin bool, opcode byte, payload []byte) error {
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	return writeRawFrame(w, b0, nil, payload)
+}
+
+// writeRawFrame writes a frame with b0 as its first byte (FIN, RSV bits and
+// opcode), masking payload with mask if it is not nil. Servers must never
+// mask frames, so a mask is only useful to violate the protocol.
+func writeRawFrame(w io.Writer, b0 byte, mask []byte, payload []byte) error {
+	frame := frameHeader(b0, mask != nil, uint64(len(payload)))
+	if mask != nil {
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// frameHeader returns the frame header for a payload of length n with b0 as
+// the first byte. It does not include a masking key even if masked is set.
+func frameHeader(b0 byte, masked bool, n uint64) []byte {
+	var b1 byte
+	if masked {
+		b1 = 0x80
+	}
+	switch {
+	case n <= 125:
+		return []byte{b0, b1 | byte(n)}
+	case n <= 0xffff:
+		h := []byte{b0, b1 | 126, 0, 0}
+		binary.BigEndian.PutUint16(h[2:], uint16(n))
+		return h
+	default:
+		h := []byte{b0, b1 | 127, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(h[2:], n)
+		return h
+	}
+}